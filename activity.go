@@ -0,0 +1,194 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/andir/UthgardCommunityHeraldBackend/timeseries"
+)
+
+const (
+	ActivityActive    = "active"
+	ActivityReturning = "returning"
+	ActivityInactive  = "inactive"
+	ActivityDormant   = "dormant"
+
+	ACTIVE_WINDOW  = 7 * 24 * time.Hour
+	DORMANT_WINDOW = 30 * 24 * time.Hour
+)
+
+// ActivityCounts counts characters by activity. Returning characters are
+// included in Active as well.
+type ActivityCounts struct {
+	Active    int
+	Returning int
+	Inactive  int
+	Dormant   int
+}
+
+func (a *ActivityCounts) Add(activity string) {
+	switch activity {
+	case ActivityReturning:
+		a.Returning += 1
+		a.Active += 1
+	case ActivityActive:
+		a.Active += 1
+	case ActivityInactive:
+		a.Inactive += 1
+	case ActivityDormant:
+		a.Dormant += 1
+	}
+}
+
+// ClassifyActivity decides whether a character is active based on the time
+// its RP or XP last changed. A character that was active in the last week
+// after a break of at least DORMANT_WINDOW is returning, returned is the
+// first change after the latest such break. If no change was ever recorded
+// lastUpdated is used instead.
+func ClassifyActivity(lastChange, returned, lastUpdated, now time.Time) (activity string, lastActive time.Time) {
+	lastActive = lastChange
+	if lastActive.IsZero() {
+		lastActive = lastUpdated
+	}
+
+	age := now.Sub(lastActive)
+	if age > DORMANT_WINDOW {
+		return ActivityDormant, lastActive
+	} else if age > ACTIVE_WINDOW {
+		return ActivityInactive, lastActive
+	}
+	if !returned.IsZero() && now.Sub(returned) <= ACTIVE_WINDOW {
+		return ActivityReturning, lastActive
+	}
+	return ActivityActive, lastActive
+}
+
+func characterChanges(characterName string) []time.Time {
+	changes := make([]time.Time, 0)
+	if ts := timeseries.CharacterRPTimeSeries(characterName); ts != nil {
+		changes = append(changes, ts.Changes()...)
+	}
+	if ts := timeseries.CharacterXPTimeSeries(characterName); ts != nil {
+		changes = append(changes, ts.Changes()...)
+	}
+	sort.Slice(changes, func(a, b int) bool { return changes[a].Before(changes[b]) })
+	return changes
+}
+
+// activityState is what UpdateActivity remembers about a character between
+// updates, so that its series only have to be read when it is first seen.
+type activityState struct {
+	Rp         uint64
+	Xp         uint64
+	LastChange time.Time
+	Returned   time.Time
+}
+
+// key: character name
+var activityStates = make(map[string]*activityState)
+
+// loadActivityState reads the changes of a character up to now from its
+// series, later ones exist when older dumps are backfilled.
+func loadActivityState(characterName string, char *Character, now time.Time) *activityState {
+	state := &activityState{Rp: char.Rp, Xp: char.Xp}
+	changes := characterChanges(characterName)
+	for i, change := range changes {
+		if change.After(now) {
+			break
+		}
+		if i > 0 && change.Sub(changes[i-1]) >= DORMANT_WINDOW {
+			state.Returned = change
+		}
+		state.LastChange = change
+	}
+	return state
+}
+
+// update records a change if the RP or XP of the character differ from the
+// last update.
+func (s *activityState) update(char *Character) {
+	if char.Rp == s.Rp && char.Xp == s.Xp {
+		return
+	}
+	s.Rp, s.Xp = char.Rp, char.Xp
+	change := time.Unix(char.LastUpdated, 0)
+	if !change.After(s.LastChange) {
+		return
+	}
+	if !s.LastChange.IsZero() && change.Sub(s.LastChange) >= DORMANT_WINDOW {
+		s.Returned = change
+	}
+	s.LastChange = change
+}
+
+// UpdateActivity classifies every character, counts them per realm, class
+// and guild and records the number of active characters as time series.
+// The series of a character are only read the first time it is seen, later
+// changes are taken from the snapshots. Not safe for concurrent use.
+func UpdateActivity(stats *Statistics, now time.Time) {
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	log.Println("Calculating activity")
+	for characterName, char := range stats.Characters {
+		state, ok := activityStates[characterName]
+		if ok {
+			state.update(char)
+		} else {
+			state = loadActivityState(characterName, char, now)
+			activityStates[characterName] = state
+		}
+		activity, lastActive := ClassifyActivity(state.LastChange, state.Returned, time.Unix(char.LastUpdated, 0), now)
+		char.Activity = activity
+		char.LastActive = lastActive.Unix()
+	}
+	// forget characters that are no longer part of the dump
+	for characterName := range activityStates {
+		if _, ok := stats.Characters[characterName]; !ok {
+			delete(activityStates, characterName)
+		}
+	}
+
+	count := func(query *Query) {
+		query.Activity = ActivityCounts{}
+		for _, char := range query.Characters {
+			query.Activity.Add(char.Activity)
+		}
+	}
+	count(&stats.Query)
+	for _, query := range stats.ByRealm {
+		count(query)
+	}
+	for _, query := range stats.ByClass {
+		count(query)
+	}
+	for _, query := range stats.ByGuild {
+		count(query)
+	}
+	log.Println("Done")
+
+	log.Println("Updating activity timeseries...")
+	wg := &sync.WaitGroup{}
+	save := func(queryType string, index map[string]*Query) {
+		for name, query := range index {
+			if len(name) == 0 {
+				continue
+			}
+			path := timeseries.TimeSeriesPath(queryType, name, "active")
+			err := timeseries.UpdateSeries(path, uint64(query.Activity.Active), now)
+			if err != nil {
+				log.Printf("Failed to save TS for %v: %v", name, err)
+			}
+		}
+		wg.Done()
+	}
+	wg.Add(3)
+	go save("realm", stats.ByRealm)
+	go save("class", stats.ByClass)
+	go save("guild", stats.ByGuild)
+	wg.Wait()
+	log.Println("Done")
+}
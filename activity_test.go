@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andir/UthgardCommunityHeraldBackend/timeseries"
+)
+
+func TestClassifyActivity(t *testing.T) {
+	day := 24 * time.Hour
+	now := time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		name                 string
+		lastChange, returned time.Time
+		lastUpdated          time.Time
+		activity             string
+		lastActive           time.Time
+	}{
+		{"changed today", now.Add(-time.Hour), time.Time{}, now, ActivityActive, now.Add(-time.Hour)},
+		{"changed a week ago", now.Add(-ACTIVE_WINDOW), time.Time{}, now, ActivityActive, now.Add(-ACTIVE_WINDOW)},
+		{"changed just over a week ago", now.Add(-ACTIVE_WINDOW - time.Second), time.Time{}, now, ActivityInactive, now.Add(-ACTIVE_WINDOW - time.Second)},
+		{"changed 30 days ago", now.Add(-DORMANT_WINDOW), time.Time{}, now, ActivityInactive, now.Add(-DORMANT_WINDOW)},
+		{"changed just over 30 days ago", now.Add(-DORMANT_WINDOW - time.Second), time.Time{}, now, ActivityDormant, now.Add(-DORMANT_WINDOW - time.Second)},
+		{"returned this week", now.Add(-day), now.Add(-3 * day), now, ActivityReturning, now.Add(-day)},
+		{"returned a week ago", now.Add(-day), now.Add(-ACTIVE_WINDOW), now, ActivityReturning, now.Add(-day)},
+		{"returned two weeks ago", now.Add(-day), now.Add(-14 * day), now, ActivityActive, now.Add(-day)},
+		{"returned but inactive again", now.Add(-10 * day), now.Add(-10 * day), now, ActivityInactive, now.Add(-10 * day)},
+		{"no change recorded, updated recently", time.Time{}, time.Time{}, now.Add(-2 * day), ActivityActive, now.Add(-2 * day)},
+		{"no change recorded, updated long ago", time.Time{}, time.Time{}, now.Add(-40 * day), ActivityDormant, now.Add(-40 * day)},
+	} {
+		activity, lastActive := ClassifyActivity(c.lastChange, c.returned, c.lastUpdated, now)
+		if activity != c.activity || !lastActive.Equal(c.lastActive) {
+			t.Errorf("%v: got %v at %v, want %v at %v", c.name, activity, lastActive, c.activity, c.lastActive)
+		}
+	}
+}
+
+func TestUpdateActivity(t *testing.T) {
+	t.Chdir(t.TempDir())
+	old := activityStates
+	activityStates = make(map[string]*activityState)
+	defer func() { activityStates = old }()
+
+	day := 24 * time.Hour
+	now := time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+	// Alice gained RP yesterday, Bob last changed 40 days ago
+	writeSeries(t, timeseries.TimeSeriesPath("character", "Alice", "rp"), map[time.Time]uint64{
+		now.Add(-3 * day): 100,
+		now.Add(-day):     200,
+	})
+	writeSeries(t, timeseries.TimeSeriesPath("character", "Bob", "xp"), map[time.Time]uint64{
+		now.Add(-50 * day): 10,
+		now.Add(-40 * day): 20,
+	})
+
+	characters := map[string]*Character{
+		"Alice": {Name: "Alice", Realm: "Albion", Rp: 200, LastUpdated: now.Add(-day).Unix()},
+		"Bob":   {Name: "Bob", Realm: "Albion", Xp: 20, LastUpdated: now.Add(-40 * day).Unix()},
+	}
+	stats := LoadCharacters(characters)
+	UpdateActivity(stats, now)
+	if got := stats.ByRealm["Albion"].Activity; got != (ActivityCounts{Active: 1, Dormant: 1}) {
+		t.Errorf("first update: %+v", got)
+	}
+	if v, _ := timeseries.RealmActiveTimeSeries("Albion").ValueAt(now); v != 1 {
+		t.Errorf("active series of Albion is %v, want 1", v)
+	}
+
+	// Bob comes back after the break, the snapshot is enough to notice
+	later := now.Add(day)
+	characters = map[string]*Character{
+		"Alice": {Name: "Alice", Realm: "Albion", Rp: 200, LastUpdated: now.Add(-day).Unix()},
+		"Bob":   {Name: "Bob", Realm: "Albion", Xp: 30, LastUpdated: later.Unix()},
+	}
+	stats = LoadCharacters(characters)
+	UpdateActivity(stats, later)
+	if got := stats.Characters["Bob"].Activity; got != ActivityReturning {
+		t.Errorf("Bob is %v, want %v", got, ActivityReturning)
+	}
+	if got := stats.ByRealm["Albion"].Activity; got != (ActivityCounts{Active: 2, Returning: 1}) {
+		t.Errorf("second update: %+v", got)
+	}
+	if v, _ := timeseries.RealmActiveTimeSeries("Albion").ValueAt(later); v != 2 {
+		t.Errorf("active series of Albion is %v, want 2", v)
+	}
+}
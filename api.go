@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"os"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -23,20 +26,67 @@ func min(a, b int) int {
 
 type APIFunction func(wr http.ResponseWriter, req *http.Request) (response, err interface{})
 
+// HTTPError is returned by endpoints to answer with a status other than
+// 400.
+type HTTPError struct {
+	Status  int
+	Message string
+}
+
+func (e *HTTPError) Error() string {
+	return e.Message
+}
+
+func errorStatus(err interface{}) int {
+	if e, ok := err.(*HTTPError); ok {
+		return e.Status
+	}
+	return http.StatusBadRequest
+}
+
+// the answer to errors that weren't written for clients
+const GENERIC_ERROR = "Well this didn't end up as expected :("
+
+// errorMessage returns the message of HTTPErrors and of the plain string
+// errors of the endpoints. Other errors may carry internals like paths and
+// are replaced by GENERIC_ERROR.
+func errorMessage(err interface{}) string {
+	switch e := err.(type) {
+	case *HTTPError:
+		return e.Message
+	case string:
+		return e
+	}
+	return GENERIC_ERROR
+}
+
 func apiEndpointWrapper(fun APIFunction) http.HandlerFunc {
 	return http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		stats := statistics
+		if stats == nil {
+			writeNotReady(wr)
+			json.NewEncoder(wr).Encode(struct {
+				Error string
+			}{
+				Error: NOT_READY,
+			})
+			return
+		}
+		if writeNotModified(stats, wr, req) {
+			return
+		}
 		response, error := fun(wr, req)
 		wr.Header().Set("Content-Type", "application/json; encoding=utf-8")
 		if error != nil {
 			log.Println(error)
-			wr.WriteHeader(http.StatusBadRequest)
+			wr.WriteHeader(errorStatus(error))
 			json.NewEncoder(wr).Encode(struct {
 				Error string
 			}{
-				Error: "Well this didn't end up as expected :(",
+				Error: GENERIC_ERROR,
 			})
 		} else {
-			wr.Header().Set("Cache-Control", "max-age=600")
+			setCacheHeaders(stats, wr, req)
 			wr.WriteHeader(http.StatusOK)
 			json.NewEncoder(wr).Encode(response)
 		}
@@ -45,9 +95,43 @@ func apiEndpointWrapper(fun APIFunction) http.HandlerFunc {
 
 // ---
 
+// resolveVar returns the name the snapshot uses for the entity named by a
+// route variable. Unknown names are returned folded, so that the series of
+// entities missing from the snapshot can still be found.
+func resolveVar(req *http.Request, key string) (string, bool) {
+	val := mux.Vars(req)[key]
+	if name, ok := statistics.Names.ByVar(key, val); ok {
+		return name, true
+	}
+	return foldName(val), false
+}
+
+// resolveParam resolves an optional query parameter naming an entity.
+func resolveParam(req *http.Request, param string, resolver func(string) (string, bool)) string {
+	val := req.URL.Query().Get(param)
+	if val == "" {
+		return ""
+	}
+	if name, ok := resolver(val); ok {
+		return name
+	}
+	return val
+}
+
+// characterParam resolves the "character" query parameter to the name of
+// the character as it appears in events.
+func characterParam(req *http.Request) string {
+	val := req.URL.Query().Get("character")
+	if key, ok := statistics.Names.Character(val); ok {
+		return statistics.Characters[key].Name
+	}
+	return val
+}
+
+// ---
+
 func characterEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
-	vars := mux.Vars(req)
-	characterName := strings.ToLower(vars["characterName"])
+	characterName, _ := resolveVar(req, "characterName")
 	char, ok := statistics.Characters[characterName]
 	if !ok {
 		return nil, "unknown character" // TODO error
@@ -98,8 +182,7 @@ func topXP(wr http.ResponseWriter, query *Query) (interface{}, interface{}) {
 }
 
 func univeralTopRPEndpoint(wr http.ResponseWriter, req *http.Request, key string, index map[string]*Query) (interface{}, interface{}) {
-	vars := mux.Vars(req)
-	val := vars[key]
+	val, _ := resolveVar(req, key)
 	stats, ok := index[val]
 	if ok {
 		return topRP(wr, stats)
@@ -110,13 +193,12 @@ func univeralTopRPEndpoint(wr http.ResponseWriter, req *http.Request, key string
 }
 
 func universalTopXPEndpoint(wr http.ResponseWriter, req *http.Request, key string, index map[string]*Query) (interface{}, interface{}) {
-	vars := mux.Vars(req)
-	val := vars[key]
+	val, _ := resolveVar(req, key)
 	stats, ok := index[val]
 	if ok {
 		return topXP(wr, stats)
 	}
-	return nil, key + "not found"
+	return nil, key + " not found"
 }
 
 // ---
@@ -134,6 +216,48 @@ func topLWXPGuildsEndpoint(wr http.ResponseWriter, req *http.Request) (interface
 	return statistics.LWXPGuilds[:MAX_RESULTS], nil
 }
 
+func moversEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
+	query := req.URL.Query()
+	window := query.Get("window")
+	if window == "" {
+		window = "7d"
+	}
+	limit, err := parseLimit(req, 100)
+	if err != nil {
+		return nil, err
+	}
+	movers, err := MoversFor(statistics, window)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*WindowMover
+	switch mux.Vars(req)["kind"] {
+	case "characters":
+		entries = movers.Characters
+	case "guilds":
+		entries = movers.Guilds
+	case "classes":
+		entries = movers.Classes
+	case "realms":
+		entries = movers.Realms
+	default:
+		return nil, "unknown kind of movers"
+	}
+
+	return struct {
+		Window string
+		Since  time.Time
+		Until  time.Time
+		Movers []WindowMover
+	}{
+		Window: movers.Window,
+		Since:  movers.Since,
+		Until:  movers.Until,
+		Movers: movers.Top(entries, resolveParam(req, "realm", statistics.Names.Realm), resolveParam(req, "class", statistics.Names.Class), limit),
+	}, nil
+}
+
 // ---
 
 func topRPEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
@@ -144,6 +268,66 @@ func topXPEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, inte
 	return topXP(wr, &statistics.Query)
 }
 
+func activityEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
+	return statistics.Activity, nil
+}
+
+func universalActivityEndpoint(wr http.ResponseWriter, req *http.Request, key string, index map[string]*Query) (interface{}, interface{}) {
+	val, _ := resolveVar(req, key)
+	stats, ok := index[val]
+	if !ok {
+		return nil, key + " not found"
+	}
+	return stats.Activity, nil
+}
+
+func realmActivityEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
+	return universalActivityEndpoint(wr, req, "realmName", statistics.ByRealm)
+}
+
+func classActivityEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
+	return universalActivityEndpoint(wr, req, "className", statistics.ByClass)
+}
+
+func guildActivityEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
+	return universalActivityEndpoint(wr, req, "guildName", statistics.ByGuild)
+}
+
+func eventsEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
+	query := req.URL.Query()
+	filter := EventFilter{
+		Type:      query.Get("type"),
+		Realm:     resolveParam(req, "realm", statistics.Names.Realm),
+		Guild:     resolveParam(req, "guild", statistics.Names.Guild),
+		Class:     resolveParam(req, "class", statistics.Names.Class),
+		Character: characterParam(req),
+	}
+	if query.Get("since") != "" {
+		since, err := parseSince(req, 0)
+		if err != nil {
+			return nil, err
+		}
+		filter.Since = since
+	}
+	limit, err := parseLimit(req, MAX_RESULTS)
+	if err != nil {
+		return nil, err
+	}
+
+	return milestones.Events(filter, limit), nil
+}
+
+func dumpsEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
+	dumps, err := dumpArchive.List()
+	if os.IsNotExist(err) {
+		return []DumpInfo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return dumps, nil
+}
+
 func totalRPEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
 	return statistics.TotalRP, nil
 }
@@ -182,19 +366,45 @@ func topClassRPEndpoint(wr http.ResponseWriter, req *http.Request) (interface{},
 	return univeralTopRPEndpoint(wr, req, "className", statistics.ByClass)
 }
 
+func classBalanceEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
+	className, _ := resolveVar(req, "className")
+	b, ok := statistics.ClassBalance[className]
+	if !ok {
+		return nil, "class not found"
+	}
+	return b, nil
+}
+
+func classesBalanceEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
+	realm := resolveParam(req, "realm", statistics.Names.Realm)
+	balances := make(ClassBalancesByRPGain, 0, len(statistics.ClassBalance))
+	for _, b := range statistics.ClassBalance {
+		if realm != "" && b.Realm != realm {
+			continue
+		}
+		balances = append(balances, b)
+	}
+	sort.Sort(&balances)
+	return balances, nil
+}
+
 // ---
 
 func totalRealmRPEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
-	vars := mux.Vars(req)
-	realmName := vars["realmName"]
-	stats := statistics.ByRealm[realmName]
+	realmName, _ := resolveVar(req, "realmName")
+	stats, ok := statistics.ByRealm[realmName]
+	if !ok {
+		return nil, "realm not found"
+	}
 	return stats.TotalRP, nil
 }
 
 func totalRealmXPEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
-	vars := mux.Vars(req)
-	realmName := vars["realmName"]
-	stats := statistics.ByRealm[realmName]
+	realmName, _ := resolveVar(req, "realmName")
+	stats, ok := statistics.ByRealm[realmName]
+	if !ok {
+		return nil, "realm not found"
+	}
 
 	return stats.TotalXP, nil
 }
@@ -207,26 +417,42 @@ func topRealmRPEndpoint(wr http.ResponseWriter, req *http.Request) (interface{},
 	return univeralTopRPEndpoint(wr, req, "realmName", statistics.ByRealm)
 }
 
+func realmsOverviewEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
+	return statistics.RealmsOverview, nil
+}
+
+func realmsRPShareHistoryEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
+	realms := make([]string, 0, len(statistics.ByRealm))
+	for realmName := range statistics.ByRealm {
+		realms = append(realms, realmName)
+	}
+	return RealmRPShareHistory(realms), nil
+}
+
 // ---
 
 func totalGuildRPEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
-	vars := mux.Vars(req)
-	guildName := vars["guildName"]
-	stats := statistics.ByGuild[guildName]
+	guildName, _ := resolveVar(req, "guildName")
+	stats, ok := statistics.ByGuild[guildName]
+	if !ok {
+		return nil, "guild not found"
+	}
 
 	return stats.TotalRP, nil
 }
 
 func totalGuildXPEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
-	vars := mux.Vars(req)
-	guildName := vars["guildName"]
-	stats := statistics.ByGuild[guildName]
+	guildName, _ := resolveVar(req, "guildName")
+	stats, ok := statistics.ByGuild[guildName]
+	if !ok {
+		return nil, "guild not found"
+	}
 
 	return stats.TotalXP, nil
 }
 
 func topGuildXPEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
-	return universalTopXPEndpoint(wr, req, "guildName", statistics.ByRealm)
+	return universalTopXPEndpoint(wr, req, "guildName", statistics.ByGuild)
 }
 
 func topGuildRPEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
@@ -236,7 +462,7 @@ func topGuildRPEndpoint(wr http.ResponseWriter, req *http.Request) (interface{},
 type TSGetter func(key string) *timeseries.TimeSeries
 
 func timeSeriesRenderer(req *http.Request, key string, getter TSGetter, wr http.ResponseWriter) (interface{}, interface{}) {
-	val := mux.Vars(req)[key]
+	val, _ := resolveVar(req, key)
 	ts := getter(val)
 	if ts == nil {
 		return nil, "unknown timeseries" // FIXME: return proper error
@@ -247,8 +473,11 @@ func timeSeriesRenderer(req *http.Request, key string, getter TSGetter, wr http.
 
 func timeSeriesValueSince(getter TSGetter, key string, since time.Duration) APIFunction {
 	return func(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
-		val := mux.Vars(req)[key]
+		val, _ := resolveVar(req, key)
 		ts := getter(val)
+		if ts == nil {
+			return nil, "unknown timeseries"
+		}
 
 		timestamp := time.Now().Add(-1 * since)
 
@@ -256,6 +485,43 @@ func timeSeriesValueSince(getter TSGetter, key string, since time.Duration) APIF
 	}
 }
 
+// parseSince reads the "since" query parameter, which may either be a
+// duration relative to now (e.g. "72h"), a unix timestamp or an RFC 3339
+// date. def is used if the parameter is missing.
+func parseSince(req *http.Request, def time.Duration) (time.Time, error) {
+	val := req.URL.Query().Get("since")
+	if val == "" {
+		return time.Now().Add(-1 * def), nil
+	}
+	if d, err := time.ParseDuration(val); err == nil {
+		if d < 0 {
+			d = -d
+		}
+		return time.Now().Add(-1 * d), nil
+	}
+	if unix, err := strconv.ParseInt(val, 10, 64); err == nil {
+		return time.Unix(unix, 0), nil
+	}
+	return time.Parse(time.RFC3339, val)
+}
+
+// parseLimit reads the "limit" query parameter and caps it at
+// MAX_RESULTS.
+func parseLimit(req *http.Request, def int) (int, error) {
+	val := req.URL.Query().Get("limit")
+	if val == "" {
+		return def, nil
+	}
+	limit, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, err
+	}
+	if limit < 0 {
+		limit = 0
+	}
+	return min(limit, MAX_RESULTS), nil
+}
+
 func guildRPHistoryEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
 	return timeSeriesRenderer(req, "guildName", timeseries.GuildRPTimeSeries, wr)
 }
@@ -290,8 +556,64 @@ func classCountHistoryEndpoint(wr http.ResponseWriter, req *http.Request) (inter
 	return timeSeriesRenderer(req, "className", timeseries.ClassCountTimeSeries, wr)
 }
 
+func guildActiveHistoryEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
+	return timeSeriesRenderer(req, "guildName", timeseries.GuildActiveTimeSeries, wr)
+}
+func realmActiveHistoryEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
+	return timeSeriesRenderer(req, "realmName", timeseries.RealmActiveTimeSeries, wr)
+}
+func classActiveHistoryEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
+	return timeSeriesRenderer(req, "className", timeseries.ClassActiveTimeSeries, wr)
+}
+
+func classLWRPHistoryEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
+	return timeSeriesRenderer(req, "className", timeseries.ClassLWRPTimeSeries, wr)
+}
+func classRPPerActiveHistoryEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
+	return timeSeriesRenderer(req, "className", timeseries.ClassRPPerActiveTimeSeries, wr)
+}
+func classTopGainersHistoryEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
+	return timeSeriesRenderer(req, "className", timeseries.ClassTopGainersTimeSeries, wr)
+}
+
+type characterRankHistory struct {
+	Global *timeseries.TimeSeries
+	Realm  *timeseries.TimeSeries
+	Class  *timeseries.TimeSeries
+}
+
+type guildRankHistory struct {
+	Global *timeseries.TimeSeries
+	Realm  *timeseries.TimeSeries
+}
+
+func characterRankHistoryEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
+	characterName, _ := resolveVar(req, "characterName")
+	ts := timeseries.CharacterRankTimeSeries(characterName)
+	if ts == nil {
+		return nil, "unknown timeseries"
+	}
+	return characterRankHistory{
+		Global: ts,
+		Realm:  timeseries.CharacterRealmRankTimeSeries(characterName),
+		Class:  timeseries.CharacterClassRankTimeSeries(characterName),
+	}, nil
+}
+
+func guildRankHistoryEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
+	guildName, _ := resolveVar(req, "guildName")
+	ts := timeseries.GuildRankTimeSeries(guildName)
+	if ts == nil {
+		return nil, "unknown timeseries"
+	}
+	return guildRankHistory{
+		Global: ts,
+		Realm:  timeseries.GuildRealmRankTimeSeries(guildName),
+	}, nil
+}
+
 func characterRPSinceEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
-	characterName := mux.Vars(req)["characterName"]
+	characterName, _ := resolveVar(req, "characterName")
 	ts := timeseries.CharacterRPTimeSeries(characterName)
 
 	if ts == nil {
@@ -302,13 +624,28 @@ func characterRPSinceEndpoint(wr http.ResponseWriter, req *http.Request) (interf
 
 // ---
 
+// searchModeFuzzy opts a legacy search into the ranked substring and typo
+// tolerant search of the search index, by default names are looked up by
+// prefix in the radix tree as they always were.
+const searchModeFuzzy = "fuzzy"
+
 func searchCharacterEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
 	vars := mux.Vars(req)
-	characterName := strings.ToLower(vars["characterName"])
+	characterName := foldName(vars["characterName"])
 
+	stats := statistics
 	characters := make([]*Character, 0)
+	if req.URL.Query().Get("mode") == searchModeFuzzy {
+		for _, result := range stats.CharacterIndex.Search(characterName, MAX_RESULTS) {
+			if character, ok := result.Value.(*Character); ok {
+				characters = append(characters, character)
+			}
+		}
+		return characters, nil
+	}
+
 	n := 0
-	characterTree.WalkPrefix(characterName, func(name string, value interface{}) bool {
+	stats.CharacterTree.WalkPrefix(characterName, func(name string, value interface{}) bool {
 		if character, ok := value.(*Character); ok {
 			characters = append(characters, character)
 		}
@@ -324,12 +661,19 @@ func searchCharacterEndpoint(wr http.ResponseWriter, req *http.Request) (interfa
 
 func searchGuildEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
 	vars := mux.Vars(req)
-	guildName := strings.ToLower(vars["guildName"])
+	guildName := foldName(vars["guildName"])
 
-	log.Printf("guildname: %v", guildName)
+	stats := statistics
 	guilds := make([]string, 0)
+	if req.URL.Query().Get("mode") == searchModeFuzzy {
+		for _, result := range stats.GuildIndex.Search(guildName, MAX_RESULTS) {
+			guilds = append(guilds, result.Name)
+		}
+		return guilds, nil
+	}
+
 	n := 0
-	guildTree.WalkPrefix(guildName, func(name string, value interface{}) bool {
+	stats.GuildTree.WalkPrefix(guildName, func(name string, value interface{}) bool {
 		if realName, ok := value.(string); ok {
 			guilds = append(guilds, realName)
 		}
@@ -342,12 +686,26 @@ func searchGuildEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}
 	return guilds, nil
 }
 
-func guildEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
-	vars := mux.Vars(req)
-	guildName, ok := vars["guildName"]
-	if !ok {
-		return nil, "missing guildName parameter"
+func searchEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
+	query := req.URL.Query()
+	q := query.Get("q")
+	if strings.TrimSpace(q) == "" {
+		return nil, "missing q parameter"
 	}
+	limit, err := parseLimit(req, 10)
+	if err != nil {
+		return nil, err
+	}
+	types := searchTypes
+	if val := query.Get("types"); val != "" {
+		types = strings.Split(val, ",")
+	}
+
+	return UnifiedSearch(statistics, q, types, limit), nil
+}
+
+func guildEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
+	guildName, _ := resolveVar(req, "guildName")
 	guild, ok := statistics.ByGuild[guildName]
 	if !ok {
 		return nil, "guild not found"
@@ -355,3 +713,145 @@ func guildEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, inte
 
 	return guild.Characters, nil
 }
+
+func guildContributionsEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
+	guildName, _ := resolveVar(req, "guildName")
+	if _, ok := statistics.ByGuild[guildName]; !ok {
+		return nil, "guild not found"
+	}
+	since, err := parseSince(req, 7*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	return GuildContributionsSince(statistics, guildName, since, time.Now()), nil
+}
+
+// ---
+
+func registerWebhookEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
+	if req.Method != http.MethodPost {
+		return nil, "webhooks have to be registered with POST"
+	}
+	if !webhooks.Authorized(req) {
+		return nil, &HTTPError{http.StatusUnauthorized, "registering a webhook requires the webhook token"}
+	}
+	hook := &Webhook{}
+	if err := json.NewDecoder(req.Body).Decode(hook); err != nil {
+		return nil, err
+	}
+	if err := webhooks.Register(hook); err != nil {
+		return nil, err
+	}
+	return hook, nil
+}
+
+func webhookEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
+	if !webhooks.Authorized(req) {
+		return nil, &HTTPError{http.StatusUnauthorized, "managing a webhook requires the webhook token"}
+	}
+	id := mux.Vars(req)["webhookID"]
+	switch req.Method {
+	case http.MethodGet:
+		hook, ok := webhooks.Get(id)
+		if !ok {
+			return nil, "webhook not found"
+		}
+		// the secret is only handed out on registration
+		hook.Secret = ""
+		return hook, nil
+	case http.MethodDelete:
+		ok, err := webhooks.Delete(id)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, "webhook not found"
+		}
+		return id, nil
+	}
+	return nil, "unsupported method"
+}
+
+func testWebhookEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
+	if req.Method != http.MethodPost {
+		return nil, "webhooks have to be tested with POST"
+	}
+	if !webhooks.Authorized(req) {
+		return nil, &HTTPError{http.StatusUnauthorized, "testing a webhook requires the webhook token"}
+	}
+	hook, ok := webhooks.Get(mux.Vars(req)["webhookID"])
+	if !ok {
+		return nil, "webhook not found"
+	}
+	n := &Notification{
+		Type:      NotificationTest,
+		Timestamp: time.Now(),
+		Message:   "This is a test notification of the Uthgard Community Herald",
+	}
+	if err := webhooks.Notify(hook, n); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// ---
+
+// parseCompare reads the names, the window and the sampling step of a
+// comparison.
+func parseCompare(req *http.Request) (names []string, timestamps []time.Time, err error) {
+	query := req.URL.Query()
+	names = make([]string, 0)
+	for _, name := range strings.Split(query.Get("names"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	since, err := parseSince(req, 30*24*time.Hour)
+	if err != nil {
+		return
+	}
+	step := 24 * time.Hour
+	if val := query.Get("step"); val != "" {
+		if step, err = parseWindow(val); err != nil {
+			return
+		}
+	}
+	timestamps, err = sampleTimestamps(since, time.Now(), step)
+	return
+}
+
+func compareCharactersEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
+	names, timestamps, err := parseCompare(req)
+	if err != nil {
+		return nil, err
+	}
+	for i := range names {
+		if name, ok := statistics.Names.Character(names[i]); ok {
+			names[i] = name
+		}
+	}
+	comparison, err := CompareCharacters(statistics, names, timestamps, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return comparison, nil
+}
+
+func compareGuildsEndpoint(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
+	names, timestamps, err := parseCompare(req)
+	if err != nil {
+		return nil, err
+	}
+	for i := range names {
+		if name, ok := statistics.Names.Guild(names[i]); ok {
+			names[i] = name
+		}
+	}
+	comparison, err := CompareGuilds(statistics, names, timestamps, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return comparison, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestLegacySearchModes(t *testing.T) {
+	stats := LoadCharacters(map[string]*Character{
+		"Alice":  {Name: "Alice", Guild: "Avalon"},
+		"Alicia": {Name: "Alicia", Guild: "Knights of Avalon"},
+		"Malice": {Name: "Malice"},
+		"Bob":    {Name: "Bob"},
+	})
+	BuildSearch(stats)
+	old := statistics
+	statistics = stats
+	defer func() { statistics = old }()
+
+	var result interface{}
+	r := mux.NewRouter()
+	r.HandleFunc("/search/character/{characterName}", func(wr http.ResponseWriter, req *http.Request) {
+		result, _ = searchCharacterEndpoint(wr, req)
+	})
+	r.HandleFunc("/search/guild/{guildName}", func(wr http.ResponseWriter, req *http.Request) {
+		result, _ = searchGuildEndpoint(wr, req)
+	})
+	search := func(path string) map[string]bool {
+		result = nil
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		names := make(map[string]bool)
+		switch r := result.(type) {
+		case []*Character:
+			for _, char := range r {
+				names[char.Name] = true
+			}
+		case []string:
+			for _, name := range r {
+				names[name] = true
+			}
+		}
+		return names
+	}
+
+	if names := search("/search/character/ali"); len(names) != 2 || !names["Alice"] || !names["Alicia"] {
+		t.Errorf("prefix search found %v", names)
+	}
+	if names := search("/search/character/ali?mode=fuzzy"); !names["Malice"] {
+		t.Errorf("fuzzy search found %v", names)
+	}
+	if names := search("/search/guild/ava"); len(names) != 1 || !names["Avalon"] {
+		t.Errorf("prefix search found %v", names)
+	}
+	if names := search("/search/guild/ava?mode=fuzzy"); !names["Knights of Avalon"] {
+		t.Errorf("fuzzy search found %v", names)
+	}
+}
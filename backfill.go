@@ -0,0 +1,134 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DumpTimestamp is the time a dump was taken at, the newest LastUpdated
+// of all characters.
+func DumpTimestamp(characters map[string]*Character) time.Time {
+	var lastUpdated int64 = 0
+	for _, value := range characters {
+		if value.LastUpdated > lastUpdated {
+			lastUpdated = value.LastUpdated
+		}
+	}
+	return time.Unix(lastUpdated, 0)
+}
+
+func isDumpFile(filename string) bool {
+	return strings.HasSuffix(filename, ".json") || strings.HasSuffix(filename, ".json.gz")
+}
+
+// readDump reads a dump as fetched from the herald, optionally gzipped.
+func readDump(filename string, v interface{}) error {
+	fh, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	var r io.Reader = fh
+	if strings.HasSuffix(filename, ".gz") {
+		gReader, err := gzip.NewReader(fh)
+		if err != nil {
+			return err
+		}
+		defer gReader.Close()
+		r = gReader
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+type dumpFile struct {
+	Path    string
+	Fetched time.Time // zero unless named by the dump archive
+}
+
+// scanDumps returns the dumps in dir oldest first without reading them.
+// Dumps of the dump archive are ordered by the time they were fetched,
+// which is part of their names, other dumps by their names.
+func scanDumps(dir string) ([]dumpFile, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	dumps := make([]dumpFile, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !isDumpFile(entry.Name()) {
+			continue
+		}
+		fetched, _, _ := parseDumpName(entry.Name())
+		dumps = append(dumps, dumpFile{Path: filepath.Join(dir, entry.Name()), Fetched: fetched})
+	}
+	sort.SliceStable(dumps, func(a, b int) bool {
+		if !dumps[a].Fetched.Equal(dumps[b].Fetched) {
+			return dumps[a].Fetched.Before(dumps[b].Fetched)
+		}
+		return dumps[a].Path < dumps[b].Path
+	})
+	return dumps, nil
+}
+
+// Backfill feeds the dumps in dir through the steps of update() that record
+// series in chronological order, each with its own timestamp. Series entries are
+// keyed by timestamp and rosters merge older updates, so running it again
+// over the same dumps doesn't change anything. Dumps with the timestamp of
+// an earlier one are skipped. It must not run while the server is
+// updating.
+func Backfill(dir string) error {
+	dumps, err := scanDumps(dir)
+	if err != nil {
+		return err
+	}
+	if len(dumps) == 0 {
+		return fmt.Errorf("no dumps found in %v", dir)
+	}
+
+	// the activity of the live snapshots doesn't apply to older dumps
+	activityStates = make(map[string]*activityState)
+	seen := make(map[int64]string)
+	for i, dump := range dumps {
+		var characters map[string]*Character
+		if err := readDump(dump.Path, &characters); err != nil {
+			log.Printf("skipping %v: %v", dump.Path, err)
+			continue
+		}
+		if len(characters) == 0 {
+			log.Printf("skipping %v: no characters", dump.Path)
+			continue
+		}
+		timestamp := DumpTimestamp(characters)
+		if previous, ok := seen[timestamp.Unix()]; ok {
+			log.Printf("skipping %v: same timestamp as %v", dump.Path, previous)
+			continue
+		}
+		seen[timestamp.Unix()] = dump.Path
+
+		log.Printf("backfilling %v (%v/%v) from %v", dump.Path, i+1, len(dumps), timestamp)
+		stats := LoadCharacters(characters)
+		stats.LastUpdated = timestamp
+		BackfillRealmXP(stats)
+		UpdateTimeseries(stats, timestamp)
+		UpdateTopLWRP(stats, timestamp)
+		UpdateActivity(stats, timestamp)
+		UpdateClassBalance(stats, timestamp)
+		UpdateRanks(stats, timestamp)
+	}
+	return nil
+}
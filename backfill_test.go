@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andir/UthgardCommunityHeraldBackend/timeseries"
+)
+
+func TestScanDumps(t *testing.T) {
+	dir := t.TempDir()
+	// not valid dumps, scanDumps orders them without reading them
+	for _, name := range []string{"1700000200-bbb.json.gz", "1700000100-aaa.json.gz", "manual.json", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "1700000000-dir.json.gz"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	dumps, err := scanDumps(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"manual.json", "1700000100-aaa.json.gz", "1700000200-bbb.json.gz"}
+	if len(dumps) != len(want) {
+		t.Fatalf("found %v dumps, want %v", dumps, want)
+	}
+	for i, name := range want {
+		if filepath.Base(dumps[i].Path) != name {
+			t.Errorf("dump %v is %v, want %v", i, dumps[i].Path, name)
+		}
+	}
+}
+
+func TestBackfill(t *testing.T) {
+	t.Chdir(t.TempDir())
+	defer func() { activityStates = make(map[string]*activityState) }()
+	lastRankDay = time.Time{}
+	defer func() { lastRankDay = time.Time{} }()
+
+	t1 := time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+	t2 := t1.Add(24 * time.Hour)
+	t0 := t1.Add(-10 * 24 * time.Hour)
+
+	// realm XP recorded with the realm's RP before the dumps
+	writeSeries(t, timeseries.TimeSeriesPath("realm", "Albion", "rp"), map[time.Time]uint64{t0: 700})
+	writeSeries(t, timeseries.TimeSeriesPath("realm", "Albion", "xp"), map[time.Time]uint64{t0: 700})
+	writeSeries(t, timeseries.TimeSeriesPath("class", "Cleric", "xp"), map[time.Time]uint64{t0: 4})
+	writeSeries(t, timeseries.TimeSeriesPath("class", "Bard", "xp"), map[time.Time]uint64{t0: 6})
+
+	dumps := []map[string]*Character{
+		{
+			"Alice": {Name: "Alice", Realm: "Albion", Class: "Cleric", Rp: 1000, Xp: 10, LastUpdated: t1.Unix()},
+			"Bob":   {Name: "Bob", Realm: "Albion", Class: "Bard", Rp: 500, Xp: 10, LastUpdated: t1.Add(-40 * 24 * time.Hour).Unix()},
+		},
+		{
+			"Alice": {Name: "Alice", Realm: "Albion", Class: "Cleric", Rp: 3000, Xp: 10, LastUpdated: t2.Unix()},
+			"Bob":   {Name: "Bob", Realm: "Albion", Class: "Bard", Rp: 800, Xp: 10, LastUpdated: t2.Unix()},
+		},
+	}
+	if err := os.Mkdir("dumps", 0755); err != nil {
+		t.Fatal(err)
+	}
+	for i, dump := range dumps {
+		data, err := json.Marshal(dump)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join("dumps", fmt.Sprintf("%v.json", i)), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := Backfill("dumps"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		series *timeseries.TimeSeries
+		name   string
+		at     time.Time
+		want   uint64
+	}{
+		{timeseries.RealmXPTimeSeries("Albion"), "realm xp", t0, 10},
+		{timeseries.RealmXPTimeSeries("Albion"), "realm xp", t2, 20},
+		{timeseries.RealmActiveTimeSeries("Albion"), "realm active", t1, 1},
+		{timeseries.RealmActiveTimeSeries("Albion"), "realm active", t2, 2},
+		{timeseries.ClassActiveTimeSeries("Bard"), "bard active", t1, 0},
+		{timeseries.ClassLWRPTimeSeries("Cleric"), "cleric lwrp", t1, 0},
+		{timeseries.ClassLWRPTimeSeries("Cleric"), "cleric lwrp", t2, 2000},
+		{timeseries.ClassRPPerActiveTimeSeries("Cleric"), "cleric rpperactive", t2, 2000},
+		{timeseries.ClassRPPerActiveTimeSeries("Bard"), "bard rpperactive", t1, 0},
+		{timeseries.ClassRPPerActiveTimeSeries("Bard"), "bard rpperactive", t2, 300},
+		{timeseries.ClassTopGainersTimeSeries("Cleric"), "cleric topgainers", t2, 1},
+		{timeseries.CharacterRankTimeSeries("Bob"), "bob rank", t2, 2},
+	} {
+		if c.series == nil {
+			t.Errorf("%v: no series", c.name)
+			continue
+		}
+		if got, ok := c.series.ValueAt(c.at); !ok || got != c.want {
+			t.Errorf("%v at %v = %v, want %v", c.name, c.at, got, c.want)
+		}
+	}
+}
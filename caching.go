@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const UPDATE_INTERVAL = 30 * time.Minute
+
+var schedule struct {
+	lock sync.RWMutex
+	next time.Time
+}
+
+func setNextUpdate(next time.Time) {
+	schedule.lock.Lock()
+	schedule.next = next
+	schedule.lock.Unlock()
+}
+
+// NextUpdate returns when the next update is scheduled to start.
+func NextUpdate() time.Time {
+	schedule.lock.RLock()
+	defer schedule.lock.RUnlock()
+	return schedule.next
+}
+
+// mutable reports whether the resources below a path change independently
+// of the snapshot, like the registered webhooks. Their responses are
+// neither cached nor validated.
+func mutable(path string) bool {
+	return strings.HasPrefix(strings.TrimPrefix(path, V1_PREFIX), "/webhooks")
+}
+
+// ETag identifies the response to a request within a snapshot. It is weak,
+// the compressed and uncompressed responses share it.
+func ETag(stats *Statistics, req *http.Request) string {
+	h := fnv.New64a()
+	h.Write([]byte(req.URL.Path))
+	h.Write([]byte{0})
+	h.Write([]byte(req.URL.RawQuery))
+	// the format may be negotiated by the Accept header
+	format, _ := exportFormat(req)
+	h.Write([]byte{0})
+	h.Write([]byte(format))
+	return fmt.Sprintf(`W/"%x-%x"`, stats.Generation, h.Sum64())
+}
+
+// etagMatches compares weakly as If-None-Match requires.
+func etagMatches(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified checks the conditional headers of a GET request against the
+// current snapshot.
+func notModified(stats *Statistics, req *http.Request) bool {
+	if stats == nil || (req.Method != http.MethodGet && req.Method != http.MethodHead) || mutable(req.URL.Path) {
+		return false
+	}
+	if header := req.Header.Get("If-None-Match"); header != "" {
+		return etagMatches(header, ETag(stats, req))
+	}
+	if header := req.Header.Get("If-Modified-Since"); header != "" {
+		since, err := http.ParseTime(header)
+		return err == nil && !stats.LastUpdated.Truncate(time.Second).After(since)
+	}
+	return false
+}
+
+// setCacheHeaders lets clients cache a response until the next update is
+// due.
+func setCacheHeaders(stats *Statistics, wr http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return
+	}
+	if mutable(req.URL.Path) {
+		wr.Header().Set("Cache-Control", "no-store")
+		return
+	}
+	maxAge := int(time.Until(NextUpdate()).Seconds())
+	if maxAge < 0 {
+		maxAge = 0
+	}
+	wr.Header().Set("Cache-Control", "max-age="+strconv.Itoa(maxAge))
+	if stats == nil {
+		return
+	}
+	wr.Header().Set("ETag", ETag(stats, req))
+	if !stats.LastUpdated.IsZero() {
+		wr.Header().Set("Last-Modified", stats.LastUpdated.UTC().Format(http.TimeFormat))
+	}
+}
+
+// writeNotModified answers a conditional request with 304 if possible.
+func writeNotModified(stats *Statistics, wr http.ResponseWriter, req *http.Request) bool {
+	if !notModified(stats, req) {
+		return false
+	}
+	setCacheHeaders(stats, wr, req)
+	wr.WriteHeader(http.StatusNotModified)
+	return true
+}
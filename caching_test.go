@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestConditionalRequests(t *testing.T) {
+	stats := &Statistics{Generation: 3}
+	req := httptest.NewRequest(http.MethodGet, "/toprp", nil)
+	etag := ETag(stats, req)
+	if !strings.HasPrefix(etag, `W/"`) {
+		t.Errorf("ETag %v is not weak", etag)
+	}
+
+	for _, header := range []string{etag, strings.TrimPrefix(etag, "W/"), `"other", ` + etag, "*"} {
+		req := httptest.NewRequest(http.MethodGet, "/toprp", nil)
+		req.Header.Set("If-None-Match", header)
+		if !notModified(stats, req) {
+			t.Errorf("If-None-Match %v does not match %v", header, etag)
+		}
+	}
+
+	for _, path := range []string{"/webhooks/abc", V1_PREFIX + "/webhooks/abc"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("If-None-Match", "*")
+		if notModified(stats, req) {
+			t.Errorf("%v answered with 304", path)
+		}
+		rec := httptest.NewRecorder()
+		setCacheHeaders(stats, rec, req)
+		if rec.Header().Get("ETag") != "" || rec.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("%v cache headers %v", path, rec.Header())
+		}
+	}
+}
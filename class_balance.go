@@ -0,0 +1,100 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/andir/UthgardCommunityHeraldBackend/timeseries"
+)
+
+const TOP_GAINERS = 100
+
+type ClassBalance struct {
+	Class  string
+	Realm  string
+	Active int
+	// mean RP of the active characters
+	AverageRP uint64
+	// RP gained by the class last week
+	WeeklyRP int64
+	// RP gained last week per active character
+	RPGainPerActive int64
+	// number and share of the class among the top RP gainers of last week
+	TopGainers     int
+	TopGainerShare float64
+}
+
+type ClassBalancesByRPGain []*ClassBalance
+
+func (s *ClassBalancesByRPGain) Swap(a, b int) { (*s)[b], (*s)[a] = (*s)[a], (*s)[b] }
+func (s *ClassBalancesByRPGain) Less(a, b int) bool {
+	return (*s)[a].RPGainPerActive > (*s)[b].RPGainPerActive
+}
+func (s *ClassBalancesByRPGain) Len() int { return len(*s) }
+
+// UpdateClassBalance derives per class metrics to compare how well classes
+// gain RP and records them as time series. It has to run after
+// UpdateTopLWRP and UpdateActivity.
+func UpdateClassBalance(stats *Statistics, now time.Time) {
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	log.Println("Calculating class balance")
+	n := min(len(stats.LWRPCharacters), TOP_GAINERS)
+	topGainers := make(map[string]int)
+	for _, char := range stats.LWRPCharacters[:n] {
+		topGainers[char.Class] += 1
+	}
+
+	stats.ClassBalance = make(map[string]*ClassBalance, len(stats.ByClass))
+	for className, query := range stats.ByClass {
+		b := &ClassBalance{
+			Class:      className,
+			Active:     query.Activity.Active,
+			WeeklyRP:   query.LWRP,
+			TopGainers: topGainers[className],
+		}
+
+		var activeRP uint64
+		for _, char := range query.Characters {
+			b.Realm = char.Realm
+			if char.Activity == ActivityActive || char.Activity == ActivityReturning {
+				activeRP += char.Rp
+			}
+		}
+		if b.Active > 0 {
+			b.AverageRP = activeRP / uint64(b.Active)
+			b.RPGainPerActive = b.WeeklyRP / int64(b.Active)
+		}
+		if n > 0 {
+			b.TopGainerShare = 100 * float64(b.TopGainers) / float64(n)
+		}
+		stats.ClassBalance[className] = b
+	}
+	log.Println("Done")
+
+	log.Println("Updating class balance timeseries...")
+	type Item struct {
+		metric string
+		value  int64
+	}
+	for className, b := range stats.ClassBalance {
+		metrics := []Item{
+			{"lwrp", b.WeeklyRP},
+			{"rpperactive", b.RPGainPerActive},
+			{"topgainers", int64(b.TopGainers)},
+		}
+		for _, metric := range metrics {
+			if metric.value < 0 {
+				metric.value = 0
+			}
+			path := timeseries.TimeSeriesPath("class", className, metric.metric)
+			err := timeseries.UpdateSeries(path, uint64(metric.value), now)
+			if err != nil {
+				log.Printf("Failed to save TS for %v: %v", className, err)
+			}
+		}
+	}
+	log.Println("Done")
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andir/UthgardCommunityHeraldBackend/timeseries"
+)
+
+func TestUpdateClassBalance(t *testing.T) {
+	t.Chdir(t.TempDir())
+	now := time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	stats := LoadCharacters(map[string]*Character{
+		"Alice": {Name: "Alice", Realm: "Albion", Class: "Cleric", Rp: 3000, Activity: ActivityActive},
+		"Bob":   {Name: "Bob", Realm: "Albion", Class: "Cleric", Rp: 1000, Activity: ActivityReturning},
+		"Carol": {Name: "Carol", Realm: "Albion", Class: "Cleric", Rp: 9000, Activity: ActivityDormant},
+		"Dave":  {Name: "Dave", Realm: "Hibernia", Class: "Bard", Rp: 5000, Activity: ActivityInactive},
+	})
+	cleric, bard := stats.ByClass["Cleric"], stats.ByClass["Bard"]
+	cleric.Activity = ActivityCounts{Active: 2, Returning: 1, Dormant: 1}
+	cleric.LWRP = 900
+	bard.Activity = ActivityCounts{Inactive: 1}
+	bard.LWRP = 50
+	stats.LWRPCharacters = CharactersByLWRP{
+		stats.Characters["Alice"], stats.Characters["Dave"], stats.Characters["Bob"],
+	}
+
+	UpdateClassBalance(stats, now)
+
+	b := stats.ClassBalance["Cleric"]
+	if b.Realm != "Albion" || b.Active != 2 || b.WeeklyRP != 900 || b.TopGainers != 2 {
+		t.Errorf("Cleric: %+v", b)
+	}
+	// dormant characters don't count towards the average
+	if b.AverageRP != 2000 || b.RPGainPerActive != 450 {
+		t.Errorf("Cleric: average %v, per active %v", b.AverageRP, b.RPGainPerActive)
+	}
+	if b.TopGainerShare < 66.6 || b.TopGainerShare > 66.7 {
+		t.Errorf("Cleric: top gainer share %v", b.TopGainerShare)
+	}
+
+	// no active characters, nothing to divide by
+	b = stats.ClassBalance["Bard"]
+	if b.Active != 0 || b.AverageRP != 0 || b.RPGainPerActive != 0 || b.WeeklyRP != 50 || b.TopGainers != 1 {
+		t.Errorf("Bard: %+v", b)
+	}
+
+	for _, c := range []struct {
+		series *timeseries.TimeSeries
+		want   uint64
+	}{
+		{timeseries.ClassLWRPTimeSeries("Cleric"), 900},
+		{timeseries.ClassRPPerActiveTimeSeries("Cleric"), 450},
+		{timeseries.ClassTopGainersTimeSeries("Cleric"), 2},
+		{timeseries.ClassRPPerActiveTimeSeries("Bard"), 0},
+	} {
+		if v, ok := c.series.ValueAt(now); !ok || v != c.want {
+			t.Errorf("series value %v, want %v", v, c.want)
+		}
+	}
+}
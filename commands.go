@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/andir/UthgardCommunityHeraldBackend/timeseries"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %v [command]\n\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Without a command the server is started. Commands:\n")
+	fmt.Fprintf(os.Stderr, "  backfill dir              feed the dumps in dir into the series\n")
+	fmt.Fprintf(os.Stderr, "  export archive.tar.gz     export all series\n")
+	fmt.Fprintf(os.Stderr, "  import archive.tar.gz     merge the series of an archive\n")
+	fmt.Fprintf(os.Stderr, "  verify archive.tar.gz     check an archive against its manifest\n")
+	fmt.Fprintf(os.Stderr, "\nLike the server, all commands work on ./data and must not run while the server is updating.\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func exportArchive(root, filename string) {
+	fh, err := os.Create(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	manifest, err := timeseries.Export(root, fh)
+	if err == nil {
+		err = fh.Close()
+	}
+	if err != nil {
+		os.Remove(filename)
+		log.Fatal(err)
+	}
+	log.Printf("exported %v series to %v", len(manifest.Files), filename)
+}
+
+func verifyArchive(filename string) {
+	fh, err := os.Open(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fh.Close()
+	manifest, err := timeseries.Verify(fh)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("%v series created at %v are intact", len(manifest.Files), manifest.Created)
+}
+
+func importArchive(root, filename string) {
+	fh, err := os.Open(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fh.Close()
+	stats, err := timeseries.Import(root, fh)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("imported %v series (%v new), %v entries added, %v already known",
+		stats.Files, stats.Created, stats.Entries, stats.Skipped)
+}
+
+// runCommand runs the command given on the command line.
+func runCommand(args []string) {
+	if len(args) != 2 {
+		usage()
+	}
+
+	switch args[0] {
+	case "backfill":
+		if err := Backfill(args[1]); err != nil {
+			log.Fatal(err)
+		}
+	case "export":
+		exportArchive("data", args[1])
+	case "import":
+		importArchive("data", args[1])
+	case "verify":
+		verifyArchive(args[1])
+	default:
+		usage()
+	}
+}
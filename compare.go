@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/andir/UthgardCommunityHeraldBackend/timeseries"
+)
+
+const (
+	MAX_COMPARE         = 10
+	MAX_COMPARE_SAMPLES = 1000
+)
+
+// the windows gains are compared over
+var compareWindows = []string{"24h", "7d", "30d"}
+
+type Gain struct {
+	RP int64
+	XP int64
+}
+
+type CompareEntry struct {
+	Name    string
+	Current interface{}
+	// values resampled to Comparison.Timestamps, null before the first entry
+	RP    []*uint64
+	XP    []*uint64
+	Gains map[string]Gain // key: window
+}
+
+type Comparison struct {
+	Timestamps []time.Time
+	Entries    []*CompareEntry
+}
+
+// sampleTimestamps returns the timestamps from since to until every step.
+func sampleTimestamps(since, until time.Time, step time.Duration) ([]time.Time, error) {
+	if step <= 0 {
+		return nil, errors.New("step has to be positive")
+	}
+	if until.Sub(since)/step >= MAX_COMPARE_SAMPLES {
+		return nil, fmt.Errorf("more than %v samples requested", MAX_COMPARE_SAMPLES)
+	}
+	timestamps := make([]time.Time, 0)
+	for t := since; !t.After(until); t = t.Add(step) {
+		timestamps = append(timestamps, t)
+	}
+	return timestamps, nil
+}
+
+func resample(ts *timeseries.TimeSeries, timestamps []time.Time) []*uint64 {
+	values := make([]*uint64, len(timestamps))
+	if ts == nil {
+		return values
+	}
+	for i, t := range timestamps {
+		if value, ok := ts.ValueAt(t); ok {
+			values[i] = &value
+		}
+	}
+	return values
+}
+
+// windowGains measures the gains of the windows ending at now against the
+// value at the start of each window.
+func windowGains(rp, xp *timeseries.TimeSeries, now time.Time) map[string]Gain {
+	results := make(map[string]Gain)
+	for _, window := range compareWindows {
+		d, _ := parseWindow(window)
+		g := Gain{}
+		if rp != nil {
+			g.RP = rp.ValueBetween(now.Add(-1*d), now)
+		}
+		if xp != nil {
+			g.XP = xp.ValueBetween(now.Add(-1*d), now)
+		}
+		results[window] = g
+	}
+	return results
+}
+
+// compareLookup returns the current statistics and the series of a name,
+// current is nil if the name is unknown.
+type compareLookup func(name string) (current interface{}, rp, xp *timeseries.TimeSeries)
+
+func compare(names []string, lookup compareLookup, timestamps []time.Time, now time.Time) (*Comparison, error) {
+	if len(names) == 0 {
+		return nil, errors.New("no names given")
+	}
+	if len(names) > MAX_COMPARE {
+		return nil, fmt.Errorf("at most %v names can be compared", MAX_COMPARE)
+	}
+
+	c := &Comparison{
+		Timestamps: timestamps,
+		Entries:    make([]*CompareEntry, 0, len(names)),
+	}
+	for _, name := range names {
+		current, rp, xp := lookup(name)
+		if current == nil {
+			return nil, fmt.Errorf("%v not found", name)
+		}
+		c.Entries = append(c.Entries, &CompareEntry{
+			Name:    name,
+			Current: current,
+			RP:      resample(rp, timestamps),
+			XP:      resample(xp, timestamps),
+			Gains:   windowGains(rp, xp, now),
+		})
+	}
+	return c, nil
+}
+
+func CompareCharacters(stats *Statistics, names []string, timestamps []time.Time, now time.Time) (*Comparison, error) {
+	return compare(names, func(name string) (interface{}, *timeseries.TimeSeries, *timeseries.TimeSeries) {
+		char, ok := stats.Characters[name]
+		if !ok {
+			return nil, nil, nil
+		}
+		return char, timeseries.CharacterRPTimeSeries(name), timeseries.CharacterXPTimeSeries(name)
+	}, timestamps, now)
+}
+
+func CompareGuilds(stats *Statistics, names []string, timestamps []time.Time, now time.Time) (*Comparison, error) {
+	return compare(names, func(name string) (interface{}, *timeseries.TimeSeries, *timeseries.TimeSeries) {
+		guild, ok := stats.Guilds[name]
+		if !ok || name == "" {
+			return nil, nil, nil
+		}
+		current := struct {
+			*Guild
+			Members int
+		}{
+			Guild:   guild,
+			Members: len(stats.ByGuild[name].Characters),
+		}
+		return current, timeseries.GuildRPTimeSeries(name), timeseries.GuildXPTimeSeries(name)
+	}, timestamps, now)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andir/UthgardCommunityHeraldBackend/timeseries"
+)
+
+func TestCompareCharactersUnevenSampling(t *testing.T) {
+	t.Chdir(t.TempDir())
+	day := 24 * time.Hour
+	now := time.Date(2026, time.February, 1, 0, 0, 0, 0, time.UTC)
+
+	stats := LoadCharacters(map[string]*Character{
+		"Alice": {Name: "Alice"},
+		"Bob":   {Name: "Bob"},
+	})
+	// sampled every few hours
+	alice := map[time.Time]uint64{}
+	for h := 0; h <= 40*24; h += 6 {
+		alice[now.Add(-40*day).Add(time.Duration(h)*time.Hour)] = uint64(1000000 + 100*h)
+	}
+	writeSeries(t, timeseries.TimeSeriesPath("character", "Alice", "rp"), alice)
+	// sampled once in a while, with a single sample in the last day and week
+	writeSeries(t, timeseries.TimeSeriesPath("character", "Bob", "rp"), map[time.Time]uint64{
+		now.Add(-35 * day):      3000000,
+		now.Add(-20 * day):      3010000,
+		now.Add(-2 * time.Hour): 3013000,
+	})
+
+	c, err := CompareCharacters(stats, []string{"Alice", "Bob"}, []time.Time{now}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]map[string]int64{
+		"Alice": {"24h": 2400, "7d": 16800, "30d": 72000},
+		"Bob":   {"24h": 3000, "7d": 3000, "30d": 13000},
+	}
+	for _, entry := range c.Entries {
+		for window, rp := range want[entry.Name] {
+			if got := entry.Gains[window].RP; got != rp {
+				t.Errorf("%v: %v RP gained within %v, want %v", entry.Name, got, window, rp)
+			}
+		}
+	}
+}
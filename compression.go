@@ -0,0 +1,167 @@
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// responses smaller than this are not worth compressing
+const COMPRESSION_THRESHOLD = 1024
+
+var compressibleTypes = []string{
+	"application/json",
+	"application/x-ndjson",
+	"text/plain",
+	"text/html",
+	"text/csv",
+}
+
+var gzipWriters = sync.Pool{
+	New: func() interface{} { return gzip.NewWriter(nil) },
+}
+
+func isCompressible(contentType string) bool {
+	for _, t := range compressibleTypes {
+		if strings.HasPrefix(contentType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func addVary(header http.Header, value string) {
+	for _, v := range header["Vary"] {
+		if strings.EqualFold(v, value) {
+			return
+		}
+	}
+	header.Add("Vary", value)
+}
+
+// negotiateEncoding picks the content coding to compress a response to the
+// request with, only gzip is supported.
+func negotiateEncoding(req *http.Request) string {
+	if req.Method == http.MethodHead {
+		return ""
+	}
+	if acceptsEncoding(req, "gzip") {
+		return "gzip"
+	}
+	return ""
+}
+
+// compressWriter holds back the start of a response until it knows whether
+// it is large enough to be compressed.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	status   int
+	buf      []byte
+	decided  bool
+	encoder  *gzip.Writer
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.decided || w.status != 0 {
+		return
+	}
+	w.status = status
+	header := w.Header()
+	if status == http.StatusNoContent || status == http.StatusNotModified ||
+		header.Get("Content-Encoding") != "" || !isCompressible(header.Get("Content-Type")) {
+		w.decide()
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.decided {
+		if w.encoder != nil {
+			return w.encoder.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= COMPRESSION_THRESHOLD {
+		w.decide()
+	}
+	return len(b), nil
+}
+
+func (w *compressWriter) decide() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	header := w.Header()
+	if w.encoding != "" && w.status == http.StatusOK && len(w.buf) >= COMPRESSION_THRESHOLD &&
+		header.Get("Content-Encoding") == "" && isCompressible(header.Get("Content-Type")) {
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+		w.encoder = gzipWriters.Get().(*gzip.Writer)
+		w.encoder.Reset(w.ResponseWriter)
+	}
+	if isCompressible(header.Get("Content-Type")) {
+		addVary(header, "Accept-Encoding")
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+	if len(w.buf) > 0 {
+		if w.encoder != nil {
+			w.encoder.Write(w.buf)
+		} else {
+			w.ResponseWriter.Write(w.buf)
+		}
+	}
+	w.buf = nil
+}
+
+// Flush sends everything written so far, which server-sent events rely on.
+func (w *compressWriter) Flush() {
+	w.decide()
+	if w.encoder != nil {
+		w.encoder.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *compressWriter) Close() {
+	if w.status == 0 && !w.decided && len(w.buf) == 0 {
+		// the handler wrote nothing, let net/http answer as usual
+		return
+	}
+	w.decide()
+	if w.encoder != nil {
+		w.encoder.Close()
+		w.encoder.Reset(nil)
+		gzipWriters.Put(w.encoder)
+	}
+}
+
+// Compress compresses the responses of handler with gzip if the
+// client accepts them and they are larger than COMPRESSION_THRESHOLD.
+func Compress(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		encoding := negotiateEncoding(req)
+		if encoding == "" {
+			handler.ServeHTTP(wr, req)
+			return
+		}
+		cw := &compressWriter{
+			ResponseWriter: wr,
+			encoding:       encoding,
+		}
+		defer cw.Close()
+		handler.ServeHTTP(cw, req)
+	})
+}
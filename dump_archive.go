@@ -0,0 +1,164 @@
+package main
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// every dump of this window is kept, older ones are thinned out to the
+	// first dump of each day
+	DUMP_KEEP_ALL = 7 * 24 * time.Hour
+	// dumps older than this are deleted
+	DUMP_RETENTION = 365 * 24 * time.Hour
+)
+
+// DumpInfo describes an archived dump. Archived dumps can be replayed with
+// the backfill command.
+type DumpInfo struct {
+	Name    string
+	Fetched time.Time
+	SHA256  string
+	Size    int64 // compressed
+}
+
+// DumpArchive stores every fetched dump gzipped as
+// <unix fetch time>-<sha256>.json.gz and skips dumps identical to the
+// previous one.
+type DumpArchive struct {
+	lock sync.Mutex
+	dir  string
+	last string // hash of the newest dump
+}
+
+func NewDumpArchive(dir string) *DumpArchive {
+	a := &DumpArchive{dir: dir}
+	dumps, err := a.List()
+	if err != nil && !os.IsNotExist(err) {
+		log.Println(err)
+	}
+	if len(dumps) > 0 {
+		a.last = dumps[len(dumps)-1].SHA256
+	}
+	return a
+}
+
+func parseDumpName(name string) (fetched time.Time, hash string, ok bool) {
+	if !strings.HasSuffix(name, ".json.gz") {
+		return
+	}
+	parts := strings.SplitN(strings.TrimSuffix(name, ".json.gz"), "-", 2)
+	if len(parts) != 2 {
+		return
+	}
+	unix, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return
+	}
+	return time.Unix(unix, 0), parts[1], true
+}
+
+// List returns all archived dumps, oldest first.
+func (a *DumpArchive) List() ([]DumpInfo, error) {
+	entries, err := ioutil.ReadDir(a.dir)
+	if err != nil {
+		return nil, err
+	}
+	dumps := make([]DumpInfo, 0, len(entries))
+	for _, entry := range entries {
+		fetched, hash, ok := parseDumpName(entry.Name())
+		if entry.IsDir() || !ok {
+			continue
+		}
+		dumps = append(dumps, DumpInfo{
+			Name:    entry.Name(),
+			Fetched: fetched,
+			SHA256:  hash,
+			Size:    entry.Size(),
+		})
+	}
+	sort.Slice(dumps, func(i, j int) bool { return dumps[i].Fetched.Before(dumps[j].Fetched) })
+	return dumps, nil
+}
+
+// Save archives a dump unless it is identical to the previous one.
+func (a *DumpArchive) Save(data []byte, fetched time.Time) (saved bool, err error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if hash == a.last {
+		return false, nil
+	}
+
+	if err := os.MkdirAll(a.dir, os.ModePerm); err != nil {
+		return false, err
+	}
+	filename := filepath.Join(a.dir, strconv.FormatInt(fetched.Unix(), 10)+"-"+hash+".json.gz")
+	// write to a temporary file first, so that no partial dumps are left
+	fh, err := ioutil.TempFile(a.dir, ".dump")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(fh.Name())
+
+	gWriter := gzip.NewWriter(fh)
+	_, err = gWriter.Write(data)
+	if err == nil {
+		err = gWriter.Close()
+	}
+	if closeErr := fh.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(fh.Name(), filename)
+	}
+	if err != nil {
+		return false, err
+	}
+	a.last = hash
+	return true, nil
+}
+
+// Prune applies the retention policy: all dumps of the last DUMP_KEEP_ALL
+// are kept, of older ones only the first of every day and none older than
+// DUMP_RETENTION.
+func (a *DumpArchive) Prune(now time.Time) (removed int) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	dumps, err := a.List()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	var day time.Time
+	for _, dump := range dumps {
+		age := now.Sub(dump.Fetched)
+		if age <= DUMP_KEEP_ALL {
+			break
+		}
+		dumpDay := dump.Fetched.UTC().Truncate(24 * time.Hour)
+		if age <= DUMP_RETENTION && !dumpDay.Equal(day) {
+			day = dumpDay
+			continue
+		}
+		if err := os.Remove(filepath.Join(a.dir, dump.Name)); err != nil {
+			log.Println(err)
+			continue
+		}
+		removed += 1
+	}
+	return
+}
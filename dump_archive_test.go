@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDumpArchiveSave(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "dumps")
+	now := time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+	a := NewDumpArchive(dir)
+
+	for i, c := range []struct {
+		data  string
+		saved bool
+	}{
+		{`{"Alice":{}}`, true},
+		{`{"Alice":{}}`, false},
+		{`{"Bob":{}}`, true},
+		{`{"Alice":{}}`, true},
+	} {
+		saved, err := a.Save([]byte(c.data), now.Add(time.Duration(i)*time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if saved != c.saved {
+			t.Errorf("dump %v: saved %v, want %v", i, saved, c.saved)
+		}
+	}
+
+	// the newest dump survives a restart
+	a = NewDumpArchive(dir)
+	if saved, _ := a.Save([]byte(`{"Alice":{}}`), now.Add(time.Hour)); saved {
+		t.Error("duplicate of the newest dump saved after a restart")
+	}
+
+	dumps, err := a.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dumps) != 3 {
+		t.Fatalf("%v dumps archived, want 3", len(dumps))
+	}
+	var characters map[string]*Character
+	if err := readDump(filepath.Join(dir, dumps[1].Name), &characters); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := characters["Bob"]; !ok || len(characters) != 1 {
+		t.Errorf("second dump contains %v", characters)
+	}
+}
+
+func TestDumpArchivePrune(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	a := NewDumpArchive(dir)
+
+	fetched := []time.Time{
+		now.Add(-400 * day),                   // beyond the retention
+		now.Add(-20*day - 2*time.Hour),        // first of its day
+		now.Add(-20*day - 1*time.Hour),        // second of the same day
+		now.Add(-20*day + 13*time.Hour),       // first of the next day
+		now.Add(-DUMP_KEEP_ALL - time.Minute), // first of its day
+		now.Add(-DUMP_KEEP_ALL + time.Minute), // kept, within DUMP_KEEP_ALL
+		now.Add(-time.Hour),
+		now,
+	}
+	for i, f := range fetched {
+		if _, err := a.Save([]byte(fmt.Sprintf(`{"dump":%v}`, i)), f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if removed := a.Prune(now); removed != 2 {
+		t.Errorf("removed %v dumps, want 2", removed)
+	}
+	dumps, err := a.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []time.Time{fetched[1], fetched[3], fetched[4], fetched[5], fetched[6], fetched[7]}
+	if len(dumps) != len(want) {
+		t.Fatalf("%v dumps left, want %v", len(dumps), len(want))
+	}
+	for i, dump := range dumps {
+		if !dump.Fetched.Equal(want[i]) {
+			t.Errorf("dump %v fetched %v, want %v", i, dump.Fetched, want[i])
+		}
+	}
+
+	// pruning again changes nothing
+	if removed := a.Prune(now); removed != 0 {
+		t.Errorf("second prune removed %v dumps", removed)
+	}
+}
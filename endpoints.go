@@ -0,0 +1,173 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/andir/UthgardCommunityHeraldBackend/timeseries"
+)
+
+// apiEndpoints is the table of the API, the routes and the OpenAPI document
+// are both generated from it.
+func apiEndpoints() []Endpoint {
+	return []Endpoint{
+		{"/toprp", topRPEndpoint, APIDoc{Summary: "Characters with the most RP", Response: topRPSample{}}},
+		{"/topxp", topXPEndpoint, APIDoc{Summary: "Characters with the most XP", Response: topXPSample{}}},
+		{"/rp", totalRPEndpoint, APIDoc{Summary: "Total RP of all characters", Response: uint64(0)}},
+		{"/xp", totalXPEndpoint, APIDoc{Summary: "Total XP of all characters", Response: uint64(0)}},
+		{"/activity", activityEndpoint, APIDoc{Summary: "Number of active, returning, inactive and dormant characters", Response: ActivityCounts{}}},
+		{"/events", eventsEndpoint, APIDoc{
+			Summary: "Milestones reached by characters and guilds, newest first",
+			Query: []APIParam{
+				{"type", "One of level, realmrank, characterrp or guildrp"},
+				realmParam,
+				{"guild", "Only include events of this guild"},
+				classParam,
+				{"character", "Only include events of this character"},
+				sinceParam,
+				limitParam,
+			},
+			Response: []Event{},
+		}},
+		{"/dumps", dumpsEndpoint, APIDoc{Summary: "Archived raw dumps of the herald, oldest first", Response: []DumpInfo{}}},
+
+		{"/webhooks", registerWebhookEndpoint, APIDoc{
+			Summary:  "Register a webhook, requires the webhook token as bearer token. The response contains the secret deliveries are signed with",
+			Methods:  []string{http.MethodPost},
+			Body:     Webhook{},
+			Response: Webhook{},
+		}},
+		{"/webhooks/{webhookID}", webhookEndpoint, APIDoc{
+			Summary:  "Show or delete a webhook, requires the webhook token as bearer token",
+			Methods:  []string{http.MethodGet, http.MethodDelete},
+			Response: Webhook{},
+		}},
+		{"/webhooks/{webhookID}/test", testWebhookEndpoint, APIDoc{
+			Summary:  "Send a test notification to a webhook, requires the webhook token as bearer token",
+			Methods:  []string{http.MethodPost},
+			Response: Notification{},
+		}},
+
+		{"/toplwxp", topLWXPCharactersEndpoint, APIDoc{Summary: "Characters by XP gained last week", Response: []*Character{}}},
+		{"/toplwrp", topLWRPCharactersEndpoint, APIDoc{Summary: "Characters by RP gained last week", Response: []*Character{}}},
+
+		{"/toplwxp/guilds", topLWXPGuildsEndpoint, APIDoc{Summary: "Guilds by XP gained last week", Response: []*Guild{}}},
+		{"/toplwrp/guilds", topLWRPGuildsEndpoint, APIDoc{Summary: "Guilds by RP gained last week", Response: []*Guild{}}},
+
+		{"/movers/{kind}", moversEndpoint, APIDoc{
+			Summary: "Biggest RP gains within a window and the rank change to the window before",
+			Query: []APIParam{
+				{"window", "24h, 7d, 30d or any other duration like 12h or 90d"},
+				realmParam,
+				classParam,
+				limitParam,
+			},
+			Response: moversSample{},
+		}},
+
+		{"/toprp/guilds", topRPGuildsEndpoint, APIDoc{Summary: "Guilds with the most RP", Response: []*Guild{}}},
+		{"/topxp/guilds", topXPGuildsEndpoint, APIDoc{Summary: "Guilds with the most XP", Response: []*Guild{}}},
+
+		{"/compare/characters", compareCharactersEndpoint, APIDoc{
+			Summary: "Current statistics, gains and aligned history of several characters",
+			Query: []APIParam{
+				{"names", "Comma separated character names"},
+				sinceParam,
+				{"step", "Distance of the samples, e.g. 1d or 6h"},
+			},
+			Response: Comparison{},
+		}},
+		{"/compare/guilds", compareGuildsEndpoint, APIDoc{
+			Summary: "Current statistics, gains and aligned history of several guilds",
+			Query: []APIParam{
+				{"names", "Comma separated guild names"},
+				sinceParam,
+				{"step", "Distance of the samples, e.g. 1d or 6h"},
+			},
+			Response: Comparison{},
+		}},
+
+		{"/search", searchEndpoint, APIDoc{
+			Summary: "Search characters, guilds, classes and races at once",
+			Query: []APIParam{
+				{"q", "Search term"},
+				{"types", "Comma separated types to search: character, guild, class and race"},
+				limitParam,
+			},
+			Response: []SearchItem{},
+		}},
+		{"/search/character/{characterName}", searchCharacterEndpoint, APIDoc{
+			Summary:  "Search characters by name",
+			Query:    []APIParam{{"mode", "fuzzy to also match within names and tolerate typos, names are matched by prefix otherwise"}},
+			Response: []*Character{},
+		}},
+		{"/search/guild/{guildName}", searchGuildEndpoint, APIDoc{
+			Summary:  "Search guilds by name",
+			Query:    []APIParam{{"mode", "fuzzy to also match within names and tolerate typos, names are matched by prefix otherwise"}},
+			Response: []string{},
+		}},
+
+		{"/character/{characterName}", characterEndpoint, APIDoc{Summary: "A character", Response: Character{}}},
+		{"/character/{characterName}/lastwrp", timeSeriesValueSince(timeseries.CharacterRPTimeSeries, "characterName", 7*24*time.Hour), APIDoc{Summary: "RP gained by a character within the last week", Response: int64(0)}},
+		{"/character/{characterName}/history/rp", characterRPHistoryEndpoint, historyDoc("RP of a character")},
+		{"/character/{characterName}/history/xp", characterXPHistoryEndpoint, historyDoc("XP of a character")},
+		{"/character/{characterName}/history/rank", characterRankHistoryEndpoint, APIDoc{Summary: "Daily global, realm and class RP rank of a character", Response: characterRankHistory{}}},
+
+		{"/class/{className}/rp", totalClassRPEndpoint, APIDoc{Summary: "Characters of a class with the most RP", Response: topRPSample{}}},
+		{"/class/{className}/xp", totalClassXPEndpoint, APIDoc{Summary: "Characters of a class with the most XP", Response: topXPSample{}}},
+		{"/class/{className}/toprp", topClassRPEndpoint, APIDoc{Summary: "Characters of a class with the most RP", Response: topRPSample{}}},
+		{"/class/{className}/topxp", topClassXPEndpoint, APIDoc{Summary: "Characters of a class with the most XP", Response: topXPSample{}}},
+		{"/class/{className}/history/rp", classRPHistoryEndpoint, historyDoc("RP of a class")},
+		{"/class/{className}/history/xp", classXPHistoryEndpoint, historyDoc("XP of a class")},
+		{"/class/{className}/history/count", classCountHistoryEndpoint, historyDoc("Number of characters of a class")},
+		{"/class/{className}/history/active", classActiveHistoryEndpoint, historyDoc("Number of active characters of a class")},
+		{"/class/{className}/activity", classActivityEndpoint, APIDoc{Summary: "Activity of the characters of a class", Response: ActivityCounts{}}},
+		{"/class/{className}/balance", classBalanceEndpoint, APIDoc{Summary: "RP efficiency of a class", Response: ClassBalance{}}},
+		{"/class/{className}/history/lwrp", classLWRPHistoryEndpoint, historyDoc("RP gained per week by a class")},
+		{"/class/{className}/history/rpperactive", classRPPerActiveHistoryEndpoint, historyDoc("RP gained per week and active character of a class")},
+		{"/class/{className}/history/topgainers", classTopGainersHistoryEndpoint, historyDoc("Characters of a class among the top RP gainers")},
+		{"/classes/balance", classesBalanceEndpoint, APIDoc{
+			Summary:  "RP efficiency of all classes",
+			Query:    []APIParam{realmParam},
+			Response: []*ClassBalance{},
+		}},
+
+		{"/realms/overview", realmsOverviewEndpoint, APIDoc{Summary: "All realms side by side", Response: RealmsOverview{}}},
+		{"/realms/history/rpshare", realmsRPShareHistoryEndpoint, APIDoc{Summary: "Share of the total RP of every realm over time", Response: map[string][]RPShareEntry{}}},
+
+		{"/realm/{realmName}/rp", totalRealmRPEndpoint, APIDoc{Summary: "Total RP of a realm", Response: uint64(0)}},
+		{"/realm/{realmName}/xp", totalRealmXPEndpoint, APIDoc{Summary: "Total XP of a realm", Response: uint64(0)}},
+		{"/realm/{realmName}/toprp", topRealmRPEndpoint, APIDoc{Summary: "Characters of a realm with the most RP", Response: topRPSample{}}},
+		{"/realm/{realmName}/topxp", topRealmXPEndpoint, APIDoc{Summary: "Characters of a realm with the most XP", Response: topXPSample{}}},
+		{"/realm/{realmName}/history/rp", realmRPHistoryEndpoint, historyDoc("RP of a realm")},
+		{"/realm/{realmName}/history/xp", realmXPHistoryEndpoint, historyDoc("XP of a realm")},
+		{"/realm/{realmName}/history/count", realmCountHistoryEndpoint, historyDoc("Number of characters of a realm")},
+		{"/realm/{realmName}/history/active", realmActiveHistoryEndpoint, historyDoc("Number of active characters of a realm")},
+		{"/realm/{realmName}/activity", realmActivityEndpoint, APIDoc{Summary: "Activity of the characters of a realm", Response: ActivityCounts{}}},
+
+		{"/guild/{guildName}", guildEndpoint, APIDoc{Summary: "Members of a guild", Response: map[string]*Character{}}},
+		{"/guild/{guildName}/rp", totalGuildRPEndpoint, APIDoc{Summary: "Total RP of a guild", Response: uint64(0)}},
+		{"/guild/{guildName}/xp", totalGuildXPEndpoint, APIDoc{Summary: "Total XP of a guild", Response: uint64(0)}},
+		{"/guild/{guildName}/toprp", topGuildRPEndpoint, APIDoc{Summary: "Members of a guild with the most RP", Response: topRPSample{}}},
+		{"/guild/{guildName}/topxp", topGuildXPEndpoint, APIDoc{Summary: "Members of a guild with the most XP", Response: topXPSample{}}},
+		{"/guild/{guildName}/lastwrp", timeSeriesValueSince(timeseries.GuildRPTimeSeries, "guildName", 7*24*time.Hour), APIDoc{Summary: "RP gained by a guild within the last week", Response: int64(0)}},
+		{"/guild/{guildName}/contributions", guildContributionsEndpoint, APIDoc{
+			Summary:  "RP and XP each member contributed to a guild",
+			Query:    []APIParam{sinceParam},
+			Response: GuildContributions{},
+		}},
+		{"/guild/{guildName}/history/rp", guildRPHistoryEndpoint, historyDoc("RP of a guild")},
+		{"/guild/{guildName}/history/xp", guildXPHistoryEndpoint, historyDoc("XP of a guild")},
+		{"/guild/{guildName}/history/count", guildCountHistoryEndpoint, historyDoc("Number of members of a guild")},
+		{"/guild/{guildName}/history/rank", guildRankHistoryEndpoint, APIDoc{Summary: "Daily global and realm RP rank of a guild", Response: guildRankHistory{}}},
+		{"/guild/{guildName}/history/active", guildActiveHistoryEndpoint, historyDoc("Number of active members of a guild")},
+		{"/guild/{guildName}/activity", guildActivityEndpoint, APIDoc{Summary: "Activity of the members of a guild", Response: ActivityCounts{}}},
+
+		// served by the broker
+		{"/stream", nil, APIDoc{
+			Summary:     "Server-sent events announcing every new snapshot",
+			Response:    SnapshotEvent{},
+			ContentType: "text/event-stream",
+		}},
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/andir/UthgardCommunityHeraldBackend/timeseries"
+)
+
+const (
+	FormatJSON   = "json"
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+
+	// rows are flushed to the client in batches of this size
+	EXPORT_FLUSH_ROWS = 500
+)
+
+var formatContentTypes = map[string]string{
+	FormatCSV:    "text/csv; charset=utf-8",
+	FormatNDJSON: "application/x-ndjson",
+}
+
+// exportFormat returns the format requested by the "format" query
+// parameter or else the Accept header.
+func exportFormat(req *http.Request) (string, error) {
+	if format := req.URL.Query().Get("format"); format != "" {
+		format = strings.ToLower(format)
+		if _, ok := formatContentTypes[format]; !ok && format != FormatJSON {
+			return "", &HTTPError{http.StatusBadRequest, fmt.Sprintf("unknown format %v", format)}
+		}
+		return format, nil
+	}
+	for _, accept := range strings.Split(req.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "text/csv":
+			return FormatCSV, nil
+		case "application/x-ndjson":
+			return FormatNDJSON, nil
+		}
+	}
+	return FormatJSON, nil
+}
+
+// RowWriter receives the rows of an export. Header has to be called before
+// the first row.
+type RowWriter interface {
+	Header(columns ...string) error
+	Row(values ...interface{}) error
+}
+
+// Exporter streams the data of an endpoint as rows.
+type Exporter func(req *http.Request, rows RowWriter) error
+
+func formatValue(value interface{}) interface{} {
+	if t, ok := value.(time.Time); ok {
+		return t.UTC().Format(time.RFC3339)
+	}
+	return value
+}
+
+type streamWriter struct {
+	wr      http.ResponseWriter
+	format  string
+	columns []string
+	started bool
+	rows    int
+	csv     *csv.Writer
+}
+
+func (w *streamWriter) Header(columns ...string) error {
+	w.columns = columns
+	w.started = true
+	w.wr.Header().Set("Content-Type", formatContentTypes[w.format])
+	w.wr.WriteHeader(http.StatusOK)
+	if w.format == FormatCSV {
+		w.csv = csv.NewWriter(w.wr)
+		return w.csv.Write(columns)
+	}
+	return nil
+}
+
+func (w *streamWriter) Row(values ...interface{}) error {
+	switch w.format {
+	case FormatCSV:
+		record := make([]string, len(values))
+		for i, value := range values {
+			record[i] = fmt.Sprint(formatValue(value))
+		}
+		if err := w.csv.Write(record); err != nil {
+			return err
+		}
+	case FormatNDJSON:
+		// build the object by hand to keep the order of the columns
+		var line bytes.Buffer
+		line.WriteByte('{')
+		for i, value := range values {
+			if i > 0 {
+				line.WriteByte(',')
+			}
+			key, _ := json.Marshal(w.columns[i])
+			val, err := json.Marshal(formatValue(value))
+			if err != nil {
+				return err
+			}
+			line.Write(key)
+			line.WriteByte(':')
+			line.Write(val)
+		}
+		line.WriteString("}\n")
+		if _, err := w.wr.Write(line.Bytes()); err != nil {
+			return err
+		}
+	}
+	w.rows += 1
+	if w.rows%EXPORT_FLUSH_ROWS == 0 {
+		w.flush()
+	}
+	return nil
+}
+
+func (w *streamWriter) flush() {
+	if w.csv != nil {
+		w.csv.Flush()
+	}
+	if flusher, ok := w.wr.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// exportWrapper serves the csv and ndjson formats of an endpoint with the
+// exporter and leaves JSON to the handler.
+func exportWrapper(exporter Exporter, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		wr.Header().Add("Vary", "Accept")
+		format, err := exportFormat(req)
+		if err == nil && format == FormatJSON {
+			handler.ServeHTTP(wr, req)
+			return
+		}
+
+		stats := statistics
+		if stats == nil {
+			handler.ServeHTTP(wr, req)
+			return
+		}
+		if err == nil {
+			if writeNotModified(stats, wr, req) {
+				return
+			}
+			setCacheHeaders(stats, wr, req)
+			w := &streamWriter{wr: wr, format: format}
+			err = exporter(req, w)
+			if w.started {
+				w.flush()
+				if err != nil {
+					log.Println(err)
+				}
+				return
+			}
+		}
+		if err != nil {
+			log.Println(err)
+			wr.Header().Del("Cache-Control")
+			wr.Header().Del("ETag")
+			wr.Header().Del("Last-Modified")
+			wr.Header().Set("Content-Type", "application/json; charset=utf-8")
+			wr.WriteHeader(errorStatus(err))
+			json.NewEncoder(wr).Encode(struct {
+				Error string
+			}{
+				Error: errorMessage(err),
+			})
+		}
+	})
+}
+
+// ---
+
+func queryParam(key string, index func() map[string]*Query) func(req *http.Request) (*Query, error) {
+	return func(req *http.Request) (*Query, error) {
+		val, _ := resolveVar(req, key)
+		query, ok := index()[val]
+		if !ok {
+			return nil, &HTTPError{http.StatusBadRequest, fmt.Sprintf("%v %v not found", key, val)}
+		}
+		return query, nil
+	}
+}
+
+func allCharacters(req *http.Request) (*Query, error) {
+	return &statistics.Query, nil
+}
+
+func exportTopRP(query func(req *http.Request) (*Query, error)) Exporter {
+	return func(req *http.Request, rows RowWriter) error {
+		q, err := query(req)
+		if err != nil {
+			return err
+		}
+		rows.Header("rank", "name", "guild", "rp")
+		for i, char := range q.SortedByRP[:min(len(q.SortedByRP), MAX_RESULTS)] {
+			if err := rows.Row(i+1, char.Name, char.Guild, char.Rp); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func exportTopXP(query func(req *http.Request) (*Query, error)) Exporter {
+	return func(req *http.Request, rows RowWriter) error {
+		q, err := query(req)
+		if err != nil {
+			return err
+		}
+		rows.Header("rank", "name", "guild", "xp")
+		for i, char := range q.SortedByXP[:min(len(q.SortedByXP), MAX_RESULTS)] {
+			if err := rows.Row(i+1, char.Name, char.Guild, char.Xp); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func exportGuilds(guilds func() []*Guild) Exporter {
+	return func(req *http.Request, rows RowWriter) error {
+		list := guilds()
+		rows.Header("rank", "name", "rp", "xp", "lwrp", "lwxp")
+		for i, guild := range list[:min(len(list), MAX_RESULTS)] {
+			if err := rows.Row(i+1, guild.Name, guild.RP, guild.XP, guild.LWRP, guild.LWXP); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func exportGuildRoster(req *http.Request, rows RowWriter) error {
+	guildName, _ := resolveVar(req, "guildName")
+	guild, ok := statistics.ByGuild[guildName]
+	if !ok {
+		return &HTTPError{http.StatusBadRequest, fmt.Sprintf("guild %v not found", guildName)}
+	}
+	members := make(CharactersByRP, 0, len(guild.Characters))
+	for _, char := range guild.Characters {
+		members = append(members, char)
+	}
+	sort.Sort(&members)
+
+	rows.Header("name", "realm", "class", "race", "level", "rp", "xp", "realmRank", "lastWeekRp", "lastWeekXp", "activity")
+	for _, char := range members {
+		err := rows.Row(char.Name, char.Realm, char.Class, char.Race, char.Level, char.Rp, char.Xp,
+			char.RealmRank, char.LastWeekRp, char.LastWeekXp, char.Activity)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func exportTimeSeries(getter TSGetter, key string) Exporter {
+	return func(req *http.Request, rows RowWriter) error {
+		val, _ := resolveVar(req, key)
+		ts := getter(val)
+		if ts == nil {
+			return &HTTPError{http.StatusBadRequest, "unknown timeseries"}
+		}
+		rows.Header("timestamp", "value")
+		for _, entry := range ts.Entries {
+			if err := rows.Row(entry.Timestamp, entry.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+var (
+	byRealm = func() map[string]*Query { return statistics.ByRealm }
+	byClass = func() map[string]*Query { return statistics.ByClass }
+	byGuild = func() map[string]*Query { return statistics.ByGuild }
+)
+
+// exporters lists the endpoints that can also be exported as csv and
+// ndjson.
+var exporters = map[string]Exporter{
+	"/toprp":                   exportTopRP(allCharacters),
+	"/topxp":                   exportTopXP(allCharacters),
+	"/realm/{realmName}/toprp": exportTopRP(queryParam("realmName", byRealm)),
+	"/realm/{realmName}/topxp": exportTopXP(queryParam("realmName", byRealm)),
+	"/class/{className}/toprp": exportTopRP(queryParam("className", byClass)),
+	"/class/{className}/topxp": exportTopXP(queryParam("className", byClass)),
+	"/guild/{guildName}/toprp": exportTopRP(queryParam("guildName", byGuild)),
+	"/guild/{guildName}/topxp": exportTopXP(queryParam("guildName", byGuild)),
+
+	"/toprp/guilds": exportGuilds(func() []*Guild { return statistics.TopRPGuilds }),
+	"/topxp/guilds": exportGuilds(func() []*Guild { return statistics.TopXPGuilds }),
+
+	"/guild/{guildName}": exportGuildRoster,
+
+	"/character/{characterName}/history/rp": exportTimeSeries(timeseries.CharacterRPTimeSeries, "characterName"),
+	"/character/{characterName}/history/xp": exportTimeSeries(timeseries.CharacterXPTimeSeries, "characterName"),
+
+	"/class/{className}/history/rp":          exportTimeSeries(timeseries.ClassRPTimeSeries, "className"),
+	"/class/{className}/history/xp":          exportTimeSeries(timeseries.ClassXPTimeSeries, "className"),
+	"/class/{className}/history/count":       exportTimeSeries(timeseries.ClassCountTimeSeries, "className"),
+	"/class/{className}/history/active":      exportTimeSeries(timeseries.ClassActiveTimeSeries, "className"),
+	"/class/{className}/history/lwrp":        exportTimeSeries(timeseries.ClassLWRPTimeSeries, "className"),
+	"/class/{className}/history/rpperactive": exportTimeSeries(timeseries.ClassRPPerActiveTimeSeries, "className"),
+	"/class/{className}/history/topgainers":  exportTimeSeries(timeseries.ClassTopGainersTimeSeries, "className"),
+
+	"/realm/{realmName}/history/rp":     exportTimeSeries(timeseries.RealmRPTimeSeries, "realmName"),
+	"/realm/{realmName}/history/xp":     exportTimeSeries(timeseries.RealmXPTimeSeries, "realmName"),
+	"/realm/{realmName}/history/count":  exportTimeSeries(timeseries.RealmCountTimeSeries, "realmName"),
+	"/realm/{realmName}/history/active": exportTimeSeries(timeseries.RealmActiveTimeSeries, "realmName"),
+
+	"/guild/{guildName}/history/rp":     exportTimeSeries(timeseries.GuildRPTimeSeries, "guildName"),
+	"/guild/{guildName}/history/xp":     exportTimeSeries(timeseries.GuildXPTimeSeries, "guildName"),
+	"/guild/{guildName}/history/count":  exportTimeSeries(timeseries.GuildCountTimeSeries, "guildName"),
+	"/guild/{guildName}/history/active": exportTimeSeries(timeseries.GuildActiveTimeSeries, "guildName"),
+}
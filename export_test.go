@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/andir/UthgardCommunityHeraldBackend/timeseries"
+	"github.com/gorilla/mux"
+)
+
+func TestExport(t *testing.T) {
+	t.Chdir(t.TempDir())
+	old := statistics
+	defer func() { statistics = old }()
+	statistics = LoadCharacters(map[string]*Character{
+		"Alice": {Name: "Alice", Guild: `Knights, of "Avalon"`, Rp: 3000},
+		"Bob":   {Name: "Bob", Rp: 1000},
+	})
+	BuildSearch(statistics)
+	statistics.Generation = 1
+
+	t0 := time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+	writeSeries(t, timeseries.TimeSeriesPath("character", "Alice", "rp"), map[time.Time]uint64{
+		t0:                     1000,
+		t0.Add(24 * time.Hour): 3000,
+	})
+
+	r := mux.NewRouter()
+	jsonHandler := http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		wr.Header().Set("Content-Type", "application/json")
+		wr.Write([]byte("json"))
+	})
+	for _, path := range []string{"/toprp", "/character/{characterName}/history/rp"} {
+		r.Handle(path, exportWrapper(exporters[path], jsonHandler))
+	}
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, c := range []struct {
+		path, accept, contentType, body string
+	}{
+		{"/toprp?format=csv", "", "text/csv; charset=utf-8",
+			"rank,name,guild,rp\n" +
+				`1,Alice,"Knights, of ""Avalon""",3000` + "\n" +
+				"2,Bob,,1000\n"},
+		{"/toprp", "application/x-ndjson", "application/x-ndjson",
+			`{"rank":1,"name":"Alice","guild":"Knights, of \"Avalon\"","rp":3000}` + "\n" +
+				`{"rank":2,"name":"Bob","guild":"","rp":1000}` + "\n"},
+		{"/character/alice/history/rp", "text/csv", "text/csv; charset=utf-8",
+			"timestamp,value\n2026-03-01T00:00:00Z,1000\n2026-03-02T00:00:00Z,3000\n"},
+		{"/character/alice/history/rp?format=ndjson", "text/csv", "application/x-ndjson",
+			`{"timestamp":"2026-03-01T00:00:00Z","value":1000}` + "\n" +
+				`{"timestamp":"2026-03-02T00:00:00Z","value":3000}` + "\n"},
+		{"/toprp", "application/json", "application/json", "json"},
+	} {
+		rec := get(c.path, c.accept)
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != c.contentType {
+			t.Errorf("%v: status %v, content type %q", c.path, rec.Code, rec.Header().Get("Content-Type"))
+		}
+		if rec.Body.String() != c.body {
+			t.Errorf("%v: body\n%v\nwant\n%v", c.path, rec.Body, c.body)
+		}
+	}
+
+	for path, message := range map[string]string{
+		"/toprp?format=xml":                          "unknown format xml",
+		"/character/nobody/history/rp?format=ndjson": "unknown timeseries",
+	} {
+		rec := get(path, "")
+		var response struct{ Error string }
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != http.StatusBadRequest || response.Error != message {
+			t.Errorf("%v: status %v, error %q", path, rec.Code, response.Error)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// number of guilds exported by default, all of them would be too many
+// series for Prometheus
+const GAME_METRICS_TOP_GUILDS = 50
+
+func writeActivity(w io.Writer, name string, counts ActivityCounts, pairs ...string) {
+	for _, a := range []struct {
+		activity string
+		count    int
+	}{
+		{ActivityActive, counts.Active},
+		{ActivityReturning, counts.Returning},
+		{ActivityInactive, counts.Inactive},
+		{ActivityDormant, counts.Dormant},
+	} {
+		writeSample(w, name, labels(append(pairs[:len(pairs):len(pairs)], "activity", a.activity)...), float64(a.count))
+	}
+}
+
+func sortedQueries(index map[string]*Query) []string {
+	names := make([]string, 0, len(index))
+	for name := range index {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// queryRealm returns the realm of the characters of a class or guild.
+func queryRealm(query *Query) string {
+	for _, char := range query.Characters {
+		return char.Realm
+	}
+	return ""
+}
+
+// ExposeGameMetrics writes the statistics of a snapshot in the Prometheus
+// text format: totals, per realm, per class and for the top guilds by RP.
+func ExposeGameMetrics(w io.Writer, stats *Statistics, topGuilds int) {
+	writeMetric(w, "herald_dump_timestamp_seconds", "gauge", "Time the herald dump was taken.")
+	writeSample(w, "herald_dump_timestamp_seconds", "", unixSeconds(stats.LastUpdated))
+	writeMetric(w, "herald_rp", "gauge", "Total RP of all characters.")
+	writeSample(w, "herald_rp", "", float64(stats.TotalRP))
+	writeMetric(w, "herald_xp", "gauge", "Total XP of all characters.")
+	writeSample(w, "herald_xp", "", float64(stats.TotalXP))
+	writeMetric(w, "herald_characters", "gauge", "Number of characters by activity.")
+	writeActivity(w, "herald_characters", stats.Activity)
+
+	realms := sortedQueries(stats.ByRealm)
+	writeMetric(w, "herald_realm_rp", "gauge", "Total RP of the characters of a realm.")
+	for _, name := range realms {
+		writeSample(w, "herald_realm_rp", labels("realm", name), float64(stats.ByRealm[name].TotalRP))
+	}
+	writeMetric(w, "herald_realm_xp", "gauge", "Total XP of the characters of a realm.")
+	for _, name := range realms {
+		writeSample(w, "herald_realm_xp", labels("realm", name), float64(stats.ByRealm[name].TotalXP))
+	}
+	writeMetric(w, "herald_realm_rp_last_week", "gauge", "RP gained by the characters of a realm during the last week.")
+	for _, name := range realms {
+		writeSample(w, "herald_realm_rp_last_week", labels("realm", name), float64(stats.ByRealm[name].LWRP))
+	}
+	writeMetric(w, "herald_realm_characters", "gauge", "Number of characters of a realm by activity.")
+	for _, name := range realms {
+		writeActivity(w, "herald_realm_characters", stats.ByRealm[name].Activity, "realm", name)
+	}
+
+	classes := sortedQueries(stats.ByClass)
+	writeMetric(w, "herald_class_rp", "gauge", "Total RP of the characters of a class.")
+	for _, name := range classes {
+		query := stats.ByClass[name]
+		writeSample(w, "herald_class_rp", labels("realm", queryRealm(query), "class", name), float64(query.TotalRP))
+	}
+	writeMetric(w, "herald_class_xp", "gauge", "Total XP of the characters of a class.")
+	for _, name := range classes {
+		query := stats.ByClass[name]
+		writeSample(w, "herald_class_xp", labels("realm", queryRealm(query), "class", name), float64(query.TotalXP))
+	}
+	writeMetric(w, "herald_class_rp_last_week", "gauge", "RP gained by the characters of a class during the last week.")
+	for _, name := range classes {
+		query := stats.ByClass[name]
+		writeSample(w, "herald_class_rp_last_week", labels("realm", queryRealm(query), "class", name), float64(query.LWRP))
+	}
+	writeMetric(w, "herald_class_characters", "gauge", "Number of characters of a class by activity.")
+	for _, name := range classes {
+		query := stats.ByClass[name]
+		writeActivity(w, "herald_class_characters", query.Activity, "realm", queryRealm(query), "class", name)
+	}
+
+	guilds := make([]*Guild, 0, topGuilds)
+	guildLabels := make([]string, 0, topGuilds)
+	for _, guild := range stats.TopRPGuilds {
+		if len(guilds) == topGuilds {
+			break
+		}
+		// characters without a guild
+		if guild.Name == "" {
+			continue
+		}
+		guilds = append(guilds, guild)
+		guildLabels = append(guildLabels, labels("realm", queryRealm(stats.ByGuild[guild.Name]), "guild", guild.Name))
+	}
+	writeMetric(w, "herald_guild_rp", "gauge", "Total RP of the members of the top guilds.")
+	for i, guild := range guilds {
+		writeSample(w, "herald_guild_rp", guildLabels[i], float64(guild.RP))
+	}
+	writeMetric(w, "herald_guild_xp", "gauge", "Total XP of the members of the top guilds.")
+	for i, guild := range guilds {
+		writeSample(w, "herald_guild_xp", guildLabels[i], float64(guild.XP))
+	}
+	writeMetric(w, "herald_guild_rp_last_week", "gauge", "RP gained by the members of the top guilds during the last week.")
+	for i, guild := range guilds {
+		writeSample(w, "herald_guild_rp_last_week", guildLabels[i], float64(guild.LWRP))
+	}
+	writeMetric(w, "herald_guild_members", "gauge", "Number of members of the top guilds.")
+	for i, guild := range guilds {
+		writeSample(w, "herald_guild_members", guildLabels[i], float64(len(stats.ByGuild[guild.Name].Characters)))
+	}
+}
+
+// gameMetricsHandler serves the statistics of the current snapshot, the
+// "guilds" query parameter sets how many of the top guilds are included.
+func gameMetricsHandler(wr http.ResponseWriter, req *http.Request) {
+	stats := statistics
+	if stats == nil {
+		http.Error(wr, "no snapshot loaded yet", http.StatusServiceUnavailable)
+		return
+	}
+	topGuilds := GAME_METRICS_TOP_GUILDS
+	if val := req.URL.Query().Get("guilds"); val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 0 {
+			http.Error(wr, "invalid guilds "+val, http.StatusBadRequest)
+			return
+		}
+		topGuilds = min(n, MAX_RESULTS)
+	}
+
+	wr.Header().Set("Content-Type", EXPOSITION_CONTENT_TYPE)
+	w := bufio.NewWriter(wr)
+	ExposeGameMetrics(w, stats, topGuilds)
+	w.Flush()
+}
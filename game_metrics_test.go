@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExposeGameMetrics(t *testing.T) {
+	old := statistics
+	defer func() { statistics = old }()
+	guild := `The "Old" \ Guard`
+	statistics = LoadCharacters(map[string]*Character{
+		"Alice": {Name: "Alice", Realm: "Midgard", Class: "Skald", Guild: guild, Rp: 3000, Xp: 10},
+		"Bob":   {Name: "Bob", Realm: "Midgard", Class: "Healer", Guild: "Valhalla", Rp: 2000, Xp: 20},
+		"Carol": {Name: "Carol", Realm: "Albion", Class: "Cleric", Rp: 5000, Xp: 30},
+	})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		gameMetricsHandler(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	rec := get("/metrics/herald")
+	if ct := rec.Header().Get("Content-Type"); ct != EXPOSITION_CONTENT_TYPE {
+		t.Errorf("Content-Type %v", ct)
+	}
+	samples := checkExposition(t, rec.Body.String())
+	for series, want := range map[string]string{
+		`herald_rp`:                                                          "10000",
+		`herald_realm_rp{realm="Midgard"}`:                                   "5000",
+		`herald_class_xp{realm="Albion",class="Cleric"}`:                     "30",
+		`herald_guild_rp{realm="Midgard",guild="The \"Old\" \\ Guard"}`:      "3000",
+		`herald_guild_members{realm="Midgard",guild="The \"Old\" \\ Guard"}`: "1",
+		`herald_guild_rp{realm="Midgard",guild="Valhalla"}`:                  "2000",
+	} {
+		if got, ok := samples[series]; !ok || got != want {
+			t.Errorf("%v = %q, want %v", series, got, want)
+		}
+	}
+	for series := range samples {
+		if series == `herald_guild_rp{realm="Albion",guild=""}` {
+			t.Error("characters without a guild exported as a guild")
+		}
+	}
+
+	samples = checkExposition(t, get("/metrics/herald?guilds=1").Body.String())
+	if _, ok := samples[`herald_guild_rp{realm="Midgard",guild="Valhalla"}`]; ok {
+		t.Error("more guilds exported than asked for")
+	}
+	if rec := get("/metrics/herald?guilds=x"); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid guilds: status %v", rec.Code)
+	}
+}
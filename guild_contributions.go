@@ -0,0 +1,116 @@
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/andir/UthgardCommunityHeraldBackend/timeseries"
+)
+
+const (
+	MembershipMember = "member"
+	MembershipJoined = "joined"
+	MembershipLeft   = "left"
+)
+
+type Contribution struct {
+	Name       string
+	Class      string
+	Realm      string
+	Membership string
+	RP         int64
+	XP         int64
+	RPShare    float64
+	XPShare    float64
+}
+
+type ContributionsByRP []*Contribution
+
+func (s *ContributionsByRP) Swap(a, b int)      { (*s)[b], (*s)[a] = (*s)[a], (*s)[b] }
+func (s *ContributionsByRP) Less(a, b int) bool { return (*s)[a].RP > (*s)[b].RP }
+func (s *ContributionsByRP) Len() int           { return len(*s) }
+
+type GuildContributions struct {
+	Guild   string
+	Since   time.Time
+	Until   time.Time
+	RP      int64
+	XP      int64
+	Members ContributionsByRP
+}
+
+// GuildContributionsSince splits the RP and XP a guild gained between
+// since and until among its members, using each member's own series.
+// Only the time a character actually spent in the guild is counted. Before
+// the guild roster was first recorded every current member is assumed to
+// have been in the guild for the whole window.
+func GuildContributionsSince(stats *Statistics, guildName string, since, until time.Time) *GuildContributions {
+	result := &GuildContributions{
+		Guild:   guildName,
+		Since:   since,
+		Until:   until,
+		Members: make(ContributionsByRP, 0),
+	}
+
+	var stays map[string][]timeseries.Membership
+	if roster := timeseries.GuildRoster(guildName); roster != nil {
+		stays = roster.MembershipsBetween(since, until)
+	} else {
+		stays = make(map[string][]timeseries.Membership)
+	}
+	// members that aren't known to the roster yet
+	if query, ok := stats.ByGuild[guildName]; ok {
+		for characterName := range query.Characters {
+			if _, ok := stays[characterName]; !ok {
+				stays[characterName] = []timeseries.Membership{{Joined: since, Left: until}}
+			}
+		}
+	}
+
+	for characterName, memberships := range stays {
+		c := &Contribution{
+			Name:       characterName,
+			Membership: MembershipMember,
+		}
+		if char, ok := stats.Characters[characterName]; ok {
+			c.Name = char.Name
+			c.Class = char.Class
+			c.Realm = char.Realm
+			if char.Guild != guildName {
+				c.Membership = MembershipLeft
+			}
+		} else {
+			c.Membership = MembershipLeft
+		}
+		if c.Membership == MembershipMember && memberships[0].Joined.After(since) {
+			c.Membership = MembershipJoined
+		}
+
+		rpSeries := timeseries.CharacterRPTimeSeries(characterName)
+		xpSeries := timeseries.CharacterXPTimeSeries(characterName)
+		for _, m := range memberships {
+			if rpSeries != nil {
+				c.RP += rpSeries.ValueBetween(m.Joined, m.Left)
+			}
+			if xpSeries != nil {
+				c.XP += xpSeries.ValueBetween(m.Joined, m.Left)
+			}
+		}
+
+		result.RP += c.RP
+		result.XP += c.XP
+		result.Members = append(result.Members, c)
+	}
+
+	for _, c := range result.Members {
+		if result.RP > 0 {
+			c.RPShare = 100 * float64(c.RP) / float64(result.RP)
+		}
+		if result.XP > 0 {
+			c.XPShare = 100 * float64(c.XP) / float64(result.XP)
+		}
+	}
+	sort.Sort(&result.Members)
+
+	return result
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andir/UthgardCommunityHeraldBackend/timeseries"
+)
+
+func writeSeries(t *testing.T, path string, entries map[time.Time]uint64) {
+	t.Helper()
+	for timestamp, value := range entries {
+		if err := timeseries.UpdateSeries(path, value, timestamp); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGuildContributionsSince(t *testing.T) {
+	t.Chdir(t.TempDir())
+	day := 24 * time.Hour
+	since := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	until := since.Add(10 * day)
+
+	stats := LoadCharacters(map[string]*Character{
+		"Alice": {Name: "Alice", Guild: "Foo", Class: "Cleric", Realm: "Albion"},
+		"Bob":   {Name: "Bob", Guild: "Foo", Class: "Wizard", Realm: "Albion"},
+		"Carol": {Name: "Carol", Guild: "Foo", Class: "Armsman", Realm: "Albion"},
+		"Dave":  {Name: "Dave", Guild: "Bar", Class: "Friar", Realm: "Albion"},
+	})
+
+	roster := timeseries.TimeSeriesPath("guild", "Foo", "roster")
+	for _, u := range []struct {
+		members []string
+		at      time.Time
+	}{
+		{[]string{"Alice", "Bob", "Dave"}, since.Add(-1 * day)},
+		// Bob and Dave leave
+		{[]string{"Alice"}, since.Add(4 * day)},
+		{[]string{"Alice", "Carol"}, since.Add(6 * day)},
+		// Bob rejoins
+		{[]string{"Alice", "Bob", "Carol"}, since.Add(8 * day)},
+	} {
+		if err := timeseries.UpdateRoster(roster, u.members, u.at); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeSeries(t, timeseries.TimeSeriesPath("character", "Alice", "rp"), map[time.Time]uint64{
+		since.Add(-2 * day): 1000,
+		since.Add(2 * day):  1500,
+		since.Add(9 * day):  2500,
+	})
+	// a long established character, the RP gained outside the guild must
+	// not be counted
+	writeSeries(t, timeseries.TimeSeriesPath("character", "Bob", "rp"), map[time.Time]uint64{
+		since.Add(-3 * day): 2000000,
+		since.Add(2 * day):  2000500,
+		since.Add(5 * day):  2001000,
+		since.Add(9 * day):  2001200,
+	})
+	// a single sample during the stay is no gain
+	writeSeries(t, timeseries.TimeSeriesPath("character", "Carol", "rp"), map[time.Time]uint64{
+		since.Add(7 * day): 50000,
+	})
+	writeSeries(t, timeseries.TimeSeriesPath("character", "Dave", "rp"), map[time.Time]uint64{
+		since.Add(-1 * day): 300,
+		since.Add(3 * day):  400,
+		since.Add(5 * day):  900,
+	})
+
+	result := GuildContributionsSince(stats, "Foo", since, until)
+
+	want := map[string]struct {
+		rp         int64
+		membership string
+	}{
+		"Alice": {1500, MembershipMember},
+		"Bob":   {700, MembershipMember},
+		"Carol": {0, MembershipJoined},
+		"Dave":  {100, MembershipLeft},
+	}
+	if len(result.Members) != len(want) {
+		t.Fatalf("%v members, want %v", len(result.Members), len(want))
+	}
+	for _, c := range result.Members {
+		w, ok := want[c.Name]
+		if !ok {
+			t.Errorf("unexpected member %v", c.Name)
+			continue
+		}
+		if c.RP != w.rp {
+			t.Errorf("%v: RP = %v, want %v", c.Name, c.RP, w.rp)
+		}
+		if c.Membership != w.membership {
+			t.Errorf("%v: membership = %v, want %v", c.Name, c.Membership, w.membership)
+		}
+	}
+	if result.RP != 2300 {
+		t.Errorf("guild RP = %v, want 2300", result.RP)
+	}
+	if share := result.Members[0].RPShare; result.Members[0].Name != "Alice" || share < 65.2 || share > 65.3 {
+		t.Errorf("top contributor %v with %v%%, want Alice with 65.2%%", result.Members[0].Name, share)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/andir/UthgardCommunityHeraldBackend/timeseries"
+)
+
+const NOT_READY = "no data loaded yet, try again after the first update"
+
+// seconds clients are asked to wait while the first snapshot is loading
+const NOT_READY_RETRY = 60
+
+// writeNotReady starts the response to a request that arrived before the
+// first snapshot was loaded.
+func writeNotReady(wr http.ResponseWriter) {
+	wr.Header().Set("Retry-After", strconv.Itoa(NOT_READY_RETRY))
+	wr.Header().Set("Content-Type", "application/json; charset=utf-8")
+	wr.WriteHeader(http.StatusServiceUnavailable)
+}
+
+func healthzHandler(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "text/plain")
+	wr.Write([]byte("ok\n"))
+}
+
+// complete reports whether everything handlers use of a snapshot has been
+// built.
+func (s *Statistics) complete() bool {
+	return s.Names != nil &&
+		s.ByRealm != nil && s.ByClass != nil && s.ByGuild != nil && s.Guilds != nil &&
+		s.CharacterTree != nil && s.GuildTree != nil &&
+		s.CharacterIndex != nil && s.GuildIndex != nil && s.ClassRaceIndex != nil &&
+		s.RealmsOverview != nil && s.ClassBalance != nil && s.Movers != nil
+}
+
+// ready reports whether a complete snapshot has been published and the
+// services the handlers use are running.
+func ready(stats *Statistics) bool {
+	return stats != nil && stats.complete() &&
+		milestones != nil && webhooks != nil && broker != nil && dumpArchive != nil
+}
+
+// readyzHandler reports ready once a complete snapshot has been published.
+func readyzHandler(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "text/plain")
+	if !ready(statistics) {
+		wr.WriteHeader(http.StatusServiceUnavailable)
+		wr.Write([]byte("not ready\n"))
+		return
+	}
+	wr.Write([]byte("ready\n"))
+}
+
+type StorageStatus struct {
+	SeriesWrites      uint64
+	SeriesWriteErrors uint64
+	Dumps             int
+	DumpBytes         int64
+	CachedResponses   int
+	CacheBytes        int
+}
+
+type Status struct {
+	Ready      bool
+	Generation int64
+
+	LastFetch   time.Time // of the current snapshot
+	LastUpdate  time.Time
+	LastSuccess time.Time
+	LastError   string
+	LastErrorAt time.Time
+	NextUpdate  time.Time
+
+	DumpTimestamp time.Time
+	DumpAge       float64 // seconds
+	DumpSize      int
+	Characters    int
+
+	Storage StorageStatus
+}
+
+func NewStatus(stats *Statistics, now time.Time) *Status {
+	state := metrics.UpdateState()
+	status := &Status{
+		Ready:       ready(stats),
+		LastUpdate:  state.LastUpdate,
+		LastSuccess: state.LastSuccess,
+		LastError:   state.LastError,
+		LastErrorAt: state.LastErrorAt,
+		NextUpdate:  NextUpdate(),
+		DumpSize:    state.DumpSize,
+	}
+	if stats != nil {
+		status.Generation = stats.Generation
+		status.LastFetch = stats.Fetched
+		status.DumpTimestamp = stats.LastUpdated
+		status.DumpAge = now.Sub(stats.LastUpdated).Seconds()
+		status.Characters = len(stats.Characters)
+	}
+
+	status.Storage.SeriesWrites, status.Storage.SeriesWriteErrors = timeseries.WriteCounts()
+	if dumpArchive != nil {
+		dumps, err := dumpArchive.List()
+		if err == nil || os.IsNotExist(err) {
+			status.Storage.Dumps = len(dumps)
+			for _, dump := range dumps {
+				status.Storage.DumpBytes += dump.Size
+			}
+		}
+	}
+	cache := responseCache.Stats()
+	status.Storage.CachedResponses = cache.Entries
+	status.Storage.CacheBytes = cache.Bytes
+	return status
+}
+
+func statusHandler(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", "application/json; charset=utf-8")
+	wr.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(wr).Encode(NewStatus(statistics, time.Now()))
+}
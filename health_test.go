@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andir/UthgardCommunityHeraldBackend/search"
+	radix "github.com/armon/go-radix"
+)
+
+func TestReadyz(t *testing.T) {
+	oldStats, oldMilestones, oldWebhooks, oldBroker, oldArchive := statistics, milestones, webhooks, broker, dumpArchive
+	defer func() {
+		statistics, milestones, webhooks, broker, dumpArchive = oldStats, oldMilestones, oldWebhooks, oldBroker, oldArchive
+	}()
+	milestones, webhooks, broker, dumpArchive = &Milestones{}, &Webhooks{}, NewBroker(), &DumpArchive{}
+
+	readyz := func() int {
+		rec := httptest.NewRecorder()
+		readyzHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rec.Code
+	}
+
+	statistics = nil
+	if code := readyz(); code != http.StatusServiceUnavailable {
+		t.Errorf("without a snapshot: %v", code)
+	}
+
+	// a snapshot whose search structures and summaries are missing
+	statistics = LoadCharacters(map[string]*Character{"Alice": {Name: "Alice", Realm: "Albion", Class: "Cleric", Guild: "Knights"}})
+	if code := readyz(); code != http.StatusServiceUnavailable {
+		t.Errorf("with an incomplete snapshot: %v", code)
+	}
+
+	statistics.CharacterTree, statistics.GuildTree = radix.New(), radix.New()
+	statistics.CharacterIndex, statistics.GuildIndex, statistics.ClassRaceIndex = search.NewIndex(), search.NewIndex(), search.NewIndex()
+	statistics.RealmsOverview = &RealmsOverview{}
+	statistics.ClassBalance = map[string]*ClassBalance{}
+	statistics.Movers = map[string]*MoversWindow{}
+	if code := readyz(); code != http.StatusOK {
+		t.Errorf("with a complete snapshot: %v", code)
+	}
+
+	webhooks = nil
+	if code := readyz(); code != http.StatusServiceUnavailable {
+		t.Errorf("without webhooks: %v", code)
+	}
+}
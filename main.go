@@ -2,15 +2,16 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
-	"strings"
+	"path/filepath"
+	"sync"
 	"time"
 
-	"github.com/andir/UthgardCommunityHeraldBackend/timeseries"
-	radix "github.com/armon/go-radix"
 	"github.com/gorilla/mux"
 )
 
@@ -36,8 +37,13 @@ func parseDump(filename string) map[string]Character {
 
 // FIXME: replace the global with a context var
 var statistics *Statistics
-var characterTree *radix.Tree
-var guildTree *radix.Tree
+
+var backfillRealmXP sync.Once
+
+var milestones *Milestones
+var webhooks *Webhooks
+var broker *Broker
+var dumpArchive *DumpArchive
 
 func guildInfoEndpoint(wr http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
@@ -76,63 +82,110 @@ func totalRPPlayers(wr http.ResponseWriter, req *http.Request) {
 	encoder.Encode(players)
 }
 
-func update() {
+func update() error {
 	url := "https://www2.uthgard.net/herald/api/dump"
+	fetched := time.Now()
 	response, err := http.Get(url)
 	if err != nil {
-		log.Println(err)
-		return
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching the dump failed: %v", response.Status)
 	}
 
 	var characters map[string]*Character
 	bytes, err := ioutil.ReadAll(response.Body)
 	if err != nil {
-		log.Println(err)
-		return
+		return err
 	}
 
-	err = json.Unmarshal(bytes, &characters)
+	if err := json.Unmarshal(bytes, &characters); err != nil {
+		return err
+	}
+	metrics.Dump(len(bytes), len(characters))
+	if saved, err := dumpArchive.Save(bytes, fetched); err != nil {
+		log.Println(err)
+	} else if saved {
+		dumpArchive.Prune(fetched)
+	}
 
-	var lastUpdatedInt int64 = 0
+	var stats *Statistics
+	metrics.Time("load", func() { stats = LoadCharacters(characters) })
+	stats.Generation = fetched.UnixNano()
+	stats.Fetched = fetched
 
-	for _, value := range characters {
-		if value.LastUpdated > lastUpdatedInt {
-			lastUpdatedInt = value.LastUpdated
-		}
-	}
+	// the search structures are part of the snapshot and have to be
+	// complete before it is published
+	searchBuilt := make(chan bool)
 	go func() {
-		ctree := radix.New()
-		for name, character := range characters {
-			ctree.Insert(strings.ToLower(name), character)
-		}
-		characterTree = ctree
+		metrics.Time("search", func() { BuildSearch(stats) })
+		close(searchBuilt)
 	}()
 
-	stats := LoadCharacters(characters)
+	backfillRealmXP.Do(func() { BackfillRealmXP(stats) })
 
-	go func() {
-		gtree := radix.New()
-		for name := range stats.ByGuild {
-			gtree.Insert(strings.ToLower(name), name)
-		}
-		guildTree = gtree
-	}()
+	lastUpdated := DumpTimestamp(characters)
+	stats.LastUpdated = lastUpdated
+	metrics.Time("timeseries", func() { UpdateTimeseries(stats, lastUpdated) })
+
+	metrics.Time("toplwrp", func() { UpdateTopLWRP(stats, lastUpdated) })
 
-	lastUpdated := time.Unix(lastUpdatedInt, 0)
-	UpdateTimeseries(stats, lastUpdated)
+	metrics.Time("activity", func() { UpdateActivity(stats, lastUpdated) })
 
-	UpdateTopLWRP(stats)
+	metrics.Time("realms", func() { UpdateRealmsOverview(stats) })
 
+	metrics.Time("classbalance", func() { UpdateClassBalance(stats, lastUpdated) })
+
+	metrics.Time("movers", func() { UpdateMovers(stats) })
+
+	metrics.Time("ranks", func() { UpdateRanks(stats, lastUpdated) })
+
+	var events []*Event
+	metrics.Time("milestones", func() { events = UpdateMilestones(stats, lastUpdated) })
+
+	webhooks.NotifyAll(statistics, stats, events, lastUpdated)
+
+	<-searchBuilt
+	prev := statistics
 	statistics = stats
+	responseCache.Invalidate(stats.Generation)
+	metrics.Time("warm", responseCache.Warm)
+
+	broker.Publish(NewSnapshotEvent(prev, stats))
+	return nil
+}
+
+// scheduledUpdate runs an update and records its outcome.
+func scheduledUpdate() {
+	start := time.Now()
+	err := update()
+	if err != nil {
+		log.Println(err)
+	}
+	metrics.Update(start, err)
 }
 
 func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() > 0 {
+		runCommand(flag.Args())
+		return
+	}
+
+	milestones = NewMilestones(LoadMilestoneConfig("milestones.json"), filepath.Join("data", "events.json"), filepath.Join("data", "milestones.json.gz"))
+	webhooks = NewWebhooks(filepath.Join("data", "webhooks.json"), os.Getenv("WEBHOOK_TOKEN"), 4)
+	broker = NewBroker()
+	dumpArchive = NewDumpArchive(filepath.Join("data", "dumps"))
 
 	go func() {
-		t := time.NewTicker(30 * time.Minute)
-		update()
+		t := time.NewTicker(UPDATE_INTERVAL)
+		setNextUpdate(time.Now().Add(UPDATE_INTERVAL))
+		scheduledUpdate()
 		for range t.C {
-			update()
+			setNextUpdate(time.Now().Add(UPDATE_INTERVAL))
+			scheduledUpdate()
 		}
 	}()
 
@@ -142,71 +195,63 @@ func main() {
 
 	r := mux.NewRouter()
 
-	endpoints := []struct {
-		Endpoint string
-		Func     APIFunction
-	}{
-
-		{"/toprp", topRPEndpoint},
-		{"/topxp", topXPEndpoint},
-		{"/rp", totalRPEndpoint},
-		{"/xp", totalXPEndpoint},
-
-		{"/toplwxp", topLWRPCharactersEndpoint},
-		{"/toplwrp", topLWXPCharactersEndpoint},
-
-		{"/toplwxp/guilds", topLWRPGuildsEndpoint},
-		{"/toplwrp/guilds", topLWXPGuildsEndpoint},
-
-		{"/toprp/guilds", topRPGuildsEndpoint},
-		{"/topxp/guilds", topXPGuildsEndpoint},
-
-		{"/search/character/{characterName}", searchCharacterEndpoint},
-		{"/search/guild/{guildName}", searchGuildEndpoint},
-
-		{"/character/{characterName}", characterEndpoint},
-		{"/character/{characterName}/lastwrp", timeSeriesValueSince(timeseries.CharacterRPTimeSeries, "characterName", 7*24*time.Hour)},
-		{"/character/{characterName}/history/rp", characterRPHistoryEndpoint},
-		{"/character/{characterName}/history/xp", characterXPHistoryEndpoint},
-
-		{"/class/{className}/rp", totalClassRPEndpoint},
-		{"/class/{className}/xp", totalClassXPEndpoint},
-		{"/class/{className}/toprp", topClassRPEndpoint},
-		{"/class/{className}/topxp", topClassXPEndpoint},
-		{"/class/{className}/history/rp", classRPHistoryEndpoint},
-		{"/class/{className}/history/xp", classXPHistoryEndpoint},
-		{"/class/{className}/history/count", classCountHistoryEndpoint},
-
-		{"/realm/{realmName}/rp", totalRealmRPEndpoint},
-		{"/realm/{realmName}/xp", totalRealmXPEndpoint},
-		{"/realm/{realmName}/toprp", topRealmRPEndpoint},
-		{"/realm/{realmName}/topxp", topRealmXPEndpoint},
-		{"/realm/{realmName}/history/rp", realmRPHistoryEndpoint},
-		{"/realm/{realmName}/history/xp", realmXPHistoryEndpoint},
-		{"/realm/{realmName}/history/count", realmCountHistoryEndpoint},
-
-		{"/guild/{guildName}", guildEndpoint},
-		{"/guild/{guildName}/rp", totalGuildRPEndpoint},
-		{"/guild/{guildName}/xp", totalGuildXPEndpoint},
-		{"/guild/{guildName}/toprp", topGuildRPEndpoint},
-		{"/guild/{guildName}/topxp", topGuildXPEndpoint},
-		{"/guild/{guildName}/lastwrp", timeSeriesValueSince(timeseries.GuildRPTimeSeries, "guildName", 7*24*time.Hour)},
-		{"/guild/{guildName}/history/rp", guildRPHistoryEndpoint},
-		{"/guild/{guildName}/history/xp", guildXPHistoryEndpoint},
-		{"/guild/{guildName}/history/count", guildCountHistoryEndpoint},
-	}
+	endpoints := apiEndpoints()
 
 	documentation := ""
 
+	hot := make(map[string]bool)
+	for _, path := range HOT_ENDPOINTS {
+		hot[path] = true
+	}
 	for _, endpoint := range endpoints {
+		if endpoint.Func == nil {
+			continue
+		}
 		log.Println(endpoint.Endpoint)
-		r.Handle(endpoint.Endpoint, apiEndpointWrapper(endpoint.Func))
+		var handler, v1Handler http.Handler = apiEndpointWrapper(endpoint.Func), v1EndpointWrapper(endpoint.Func)
+		if !mutable(endpoint.Endpoint) {
+			handler, v1Handler = responseCache.Handler(handler), responseCache.Handler(v1Handler)
+		}
+		if hot[endpoint.Endpoint] {
+			responseCache.Hot(endpoint.Endpoint, handler)
+			responseCache.Hot(V1_PREFIX+endpoint.Endpoint, v1Handler)
+		}
+		if exporter, ok := exporters[endpoint.Endpoint]; ok {
+			handler, v1Handler = exportWrapper(exporter, handler), exportWrapper(exporter, v1Handler)
+		}
+		r.Handle(endpoint.Endpoint, metrics.Instrument(endpoint.Endpoint, handler))
+		r.Handle(V1_PREFIX+endpoint.Endpoint, metrics.Instrument(V1_PREFIX+endpoint.Endpoint, v1Handler))
+	}
+	r.Handle("/stream", broker)
+	r.Handle("/healthz", http.HandlerFunc(healthzHandler))
+	r.Handle("/readyz", http.HandlerFunc(readyzHandler))
+	r.Handle("/status", http.HandlerFunc(statusHandler))
+	r.Handle("/metrics", metrics)
+	r.Handle("/metrics/herald", responseCache.Handler(http.HandlerFunc(gameMetricsHandler)))
+
+	for _, endpoint := range endpoints {
+		documentation += endpoint.Endpoint + "\t" + endpoint.Doc.Summary + "\n"
+	}
+	documentation += "\nAll endpoints are also available below " + V1_PREFIX + " with lowerCamel field names, wrapped in an envelope and paginated by offset and limit.\n"
+	documentation += "\nLeaderboards, guild rosters and histories can be exported with ?format=csv or ?format=ndjson.\n"
+	documentation += "\nOpenAPI: /openapi.json\nExplorer: /explorer\nHealth: /healthz, /readyz and /status\nMetrics: /metrics\nGame statistics for Prometheus: /metrics/herald\n"
 
-		documentation += endpoint.Endpoint + "\n"
+	openapi, err := json.Marshal(NewOpenAPI(endpoints))
+	if err != nil {
+		log.Fatal(err)
 	}
+	r.Handle("/openapi.json", http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		wr.Header().Set("Content-Type", "application/json; charset=utf-8")
+		wr.Write(openapi)
+	}))
+	r.Handle("/explorer", http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		wr.Header().Set("Content-Type", "text/html; charset=utf-8")
+		wr.Write([]byte(explorerHTML))
+	}))
+
 	r.Handle("/", http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
 		wr.Header().Set("Content-Type", "text/plain")
 		wr.Write([]byte(documentation))
 	}))
-	http.ListenAndServe("127.0.0.1:8081", r)
+	http.ListenAndServe("127.0.0.1:8081", Compress(r))
 }
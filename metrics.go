@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andir/UthgardCommunityHeraldBackend/timeseries"
+)
+
+// content type of the Prometheus text exposition format
+const EXPOSITION_CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	stageBuckets   = []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+	requestBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+)
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels formats label pairs given as name, value, name, value...
+func labels(pairs ...string) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, pairs[i]+`="`+labelEscaper.Replace(pairs[i+1])+`"`)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// writeMetric writes the HELP and TYPE lines of a metric.
+func writeMetric(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %v %v\n# TYPE %v %v\n", name, help, name, kind)
+}
+
+// unixSeconds is 0 for the zero time rather than a large negative number.
+func unixSeconds(t time.Time) float64 {
+	if t.IsZero() {
+		return 0
+	}
+	return float64(t.Unix())
+}
+
+func writeSample(w io.Writer, name, labels string, value float64) {
+	fmt.Fprintf(w, "%v%v %v\n", name, labels, formatFloat(value))
+}
+
+// Histogram counts observations in cumulative buckets.
+type Histogram struct {
+	lock    sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func NewHistogram(buckets []float64) *Histogram {
+	return &Histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i] += 1
+		}
+	}
+	h.sum += v
+	h.count += 1
+}
+
+// write writes the samples of the histogram, pairs are the labels that
+// identify it.
+func (h *Histogram) write(w io.Writer, name string, pairs ...string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for i, upper := range h.buckets {
+		writeSample(w, name+"_bucket", labels(append(pairs[:len(pairs):len(pairs)], "le", formatFloat(upper))...), float64(h.counts[i]))
+	}
+	writeSample(w, name+"_bucket", labels(append(pairs[:len(pairs):len(pairs)], "le", "+Inf")...), float64(h.count))
+	writeSample(w, name+"_sum", labels(pairs...), h.sum)
+	writeSample(w, name+"_count", labels(pairs...), float64(h.count))
+}
+
+type requestKey struct {
+	endpoint string
+	code     int
+}
+
+// Metrics collects measurements of the backend itself.
+type Metrics struct {
+	lock sync.Mutex
+
+	updates        map[string]uint64 // key: "success" or "failure"
+	lastUpdate     time.Time
+	lastSuccess    time.Time
+	lastError      error
+	lastErrorAt    time.Time
+	updateDuration float64
+	dumpSize       int
+	characters     int
+	stages         map[string]*Histogram
+
+	requests        map[requestKey]uint64
+	requestDuration map[string]*Histogram // key: endpoint
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		updates:         map[string]uint64{"success": 0, "failure": 0},
+		stages:          make(map[string]*Histogram),
+		requests:        make(map[requestKey]uint64),
+		requestDuration: make(map[string]*Histogram),
+	}
+}
+
+// Time runs a step of the update and records how long it took.
+func (m *Metrics) Time(stage string, fn func()) {
+	start := time.Now()
+	fn()
+	m.lock.Lock()
+	h, ok := m.stages[stage]
+	if !ok {
+		h = NewHistogram(stageBuckets)
+		m.stages[stage] = h
+	}
+	m.lock.Unlock()
+	h.Observe(time.Since(start).Seconds())
+}
+
+// Update records the outcome of an update that started at start.
+func (m *Metrics) Update(start time.Time, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.lastUpdate = start
+	m.updateDuration = time.Since(start).Seconds()
+	if err != nil {
+		m.updates["failure"] += 1
+		m.lastError = err
+		m.lastErrorAt = start
+		return
+	}
+	m.updates["success"] += 1
+	m.lastSuccess = start
+}
+
+// UpdateState summarizes the recent updates.
+type UpdateState struct {
+	LastUpdate  time.Time
+	LastSuccess time.Time
+	LastError   string
+	LastErrorAt time.Time
+	Duration    float64 // seconds
+	DumpSize    int
+}
+
+func (m *Metrics) UpdateState() UpdateState {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	state := UpdateState{
+		LastUpdate:  m.lastUpdate,
+		LastSuccess: m.lastSuccess,
+		LastErrorAt: m.lastErrorAt,
+		Duration:    m.updateDuration,
+		DumpSize:    m.dumpSize,
+	}
+	if m.lastError != nil {
+		state.LastError = m.lastError.Error()
+	}
+	return state
+}
+
+// Dump records the size and number of characters of a fetched dump.
+func (m *Metrics) Dump(size, characters int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.dumpSize = size
+	m.characters = characters
+}
+
+// statusRecorder remembers the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Instrument measures the latency and status codes of an endpoint.
+func (m *Metrics) Instrument(endpoint string, handler http.Handler) http.Handler {
+	h := NewHistogram(requestBuckets)
+	m.lock.Lock()
+	m.requestDuration[endpoint] = h
+	m.lock.Unlock()
+
+	return http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: wr}
+		handler.ServeHTTP(rec, req)
+		h.Observe(time.Since(start).Seconds())
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		m.lock.Lock()
+		m.requests[requestKey{endpoint, rec.status}] += 1
+		m.lock.Unlock()
+	})
+}
+
+func sortedKeys(m map[string]*Histogram) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Expose writes all metrics in the Prometheus text format.
+func (m *Metrics) Expose(w io.Writer) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	writeMetric(w, "herald_updates_total", "counter", "Number of updates by result.")
+	for _, result := range []string{"success", "failure"} {
+		writeSample(w, "herald_updates_total", labels("result", result), float64(m.updates[result]))
+	}
+	writeMetric(w, "herald_update_duration_seconds", "gauge", "Duration of the last update.")
+	writeSample(w, "herald_update_duration_seconds", "", m.updateDuration)
+	writeMetric(w, "herald_last_update_timestamp_seconds", "gauge", "Start of the last update.")
+	writeSample(w, "herald_last_update_timestamp_seconds", "", unixSeconds(m.lastUpdate))
+	writeMetric(w, "herald_last_successful_update_timestamp_seconds", "gauge", "Start of the last successful update.")
+	writeSample(w, "herald_last_successful_update_timestamp_seconds", "", unixSeconds(m.lastSuccess))
+	writeMetric(w, "herald_update_stage_duration_seconds", "histogram", "Duration of the steps of an update.")
+	for _, stage := range sortedKeys(m.stages) {
+		m.stages[stage].write(w, "herald_update_stage_duration_seconds", "stage", stage)
+	}
+
+	writeMetric(w, "herald_dump_size_bytes", "gauge", "Size of the last fetched dump.")
+	writeSample(w, "herald_dump_size_bytes", "", float64(m.dumpSize))
+	writeMetric(w, "herald_dump_characters", "gauge", "Number of characters in the last fetched dump.")
+	writeSample(w, "herald_dump_characters", "", float64(m.characters))
+
+	written, failed := timeseries.WriteCounts()
+	writeMetric(w, "herald_series_writes_total", "counter", "Number of series saved.")
+	writeSample(w, "herald_series_writes_total", "", float64(written))
+	writeMetric(w, "herald_series_write_errors_total", "counter", "Number of series that could not be saved.")
+	writeSample(w, "herald_series_write_errors_total", "", float64(failed))
+
+	writeMetric(w, "herald_http_requests_total", "counter", "Number of requests by endpoint and status code.")
+	keys := make([]requestKey, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		if keys[a].endpoint != keys[b].endpoint {
+			return keys[a].endpoint < keys[b].endpoint
+		}
+		return keys[a].code < keys[b].code
+	})
+	for _, key := range keys {
+		writeSample(w, "herald_http_requests_total", labels("endpoint", key.endpoint, "code", strconv.Itoa(key.code)), float64(m.requests[key]))
+	}
+	writeMetric(w, "herald_http_request_duration_seconds", "histogram", "Latency of requests by endpoint.")
+	for _, endpoint := range sortedKeys(m.requestDuration) {
+		m.requestDuration[endpoint].write(w, "herald_http_request_duration_seconds", "endpoint", endpoint)
+	}
+
+	cache := responseCache.Stats()
+	writeMetric(w, "herald_response_cache_hits_total", "counter", "Number of responses served from the cache.")
+	writeSample(w, "herald_response_cache_hits_total", "", float64(cache.Hits))
+	writeMetric(w, "herald_response_cache_misses_total", "counter", "Number of responses that had to be encoded.")
+	writeSample(w, "herald_response_cache_misses_total", "", float64(cache.Misses))
+	writeMetric(w, "herald_response_cache_entries", "gauge", "Number of cached responses.")
+	writeSample(w, "herald_response_cache_entries", "", float64(cache.Entries))
+	writeMetric(w, "herald_response_cache_bytes", "gauge", "Size of the cached responses.")
+	writeSample(w, "herald_response_cache_bytes", "", float64(cache.Bytes))
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	writeMetric(w, "herald_goroutines", "gauge", "Number of goroutines.")
+	writeSample(w, "herald_goroutines", "", float64(runtime.NumGoroutine()))
+	writeMetric(w, "herald_heap_alloc_bytes", "gauge", "Bytes of allocated heap objects.")
+	writeSample(w, "herald_heap_alloc_bytes", "", float64(mem.HeapAlloc))
+}
+
+func (m *Metrics) ServeHTTP(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", EXPOSITION_CONTENT_TYPE)
+	w := bufio.NewWriter(wr)
+	m.Expose(w)
+	w.Flush()
+}
+
+var metrics = NewMetrics()
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// checkExposition verifies that every sample of a metric follows its HELP
+// and TYPE lines and returns the samples.
+func checkExposition(t *testing.T, text string) map[string]string {
+	t.Helper()
+	help := make(map[string]bool)
+	types := make(map[string]string)
+	samples := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		if strings.HasPrefix(line, "# HELP ") {
+			fields := strings.SplitN(line, " ", 4)
+			if len(fields) != 4 || fields[3] == "" {
+				t.Errorf("HELP without text: %q", line)
+			}
+			help[fields[2]] = true
+			continue
+		}
+		if strings.HasPrefix(line, "# TYPE ") {
+			fields := strings.Fields(line)
+			if len(fields) != 4 {
+				t.Errorf("malformed TYPE: %q", line)
+				continue
+			}
+			if !help[fields[2]] {
+				t.Errorf("TYPE of %v before its HELP", fields[2])
+			}
+			types[fields[2]] = fields[3]
+			continue
+		}
+
+		i := strings.LastIndex(line, " ")
+		if i < 0 {
+			t.Errorf("malformed sample: %q", line)
+			continue
+		}
+		series, value := line[:i], line[i+1:]
+		name := series
+		if j := strings.Index(series, "{"); j >= 0 {
+			name = series[:j]
+		}
+		family := name
+		for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+			if base := strings.TrimSuffix(name, suffix); base != name && types[base] == "histogram" {
+				family = base
+			}
+		}
+		if types[family] == "" {
+			t.Errorf("sample of %v without HELP and TYPE", family)
+		}
+		samples[series] = value
+	}
+	return samples
+}
+
+func TestLabels(t *testing.T) {
+	for _, c := range []struct {
+		pairs []string
+		want  string
+	}{
+		{nil, ""},
+		{[]string{"realm", "Albion"}, `{realm="Albion"}`},
+		{[]string{"guild", `The "Old" \ Guard`, "realm", "Midgard"}, `{guild="The \"Old\" \\ Guard",realm="Midgard"}`},
+		{[]string{"endpoint", "a\nb"}, `{endpoint="a\nb"}`},
+	} {
+		if got := labels(c.pairs...); got != c.want {
+			t.Errorf("labels(%q) = %v, want %v", c.pairs, got, c.want)
+		}
+	}
+}
+
+func TestMetricsExpose(t *testing.T) {
+	m := NewMetrics()
+	m.Time("load", func() {})
+	m.Update(time.Unix(1700000000, 0), nil)
+	m.Update(time.Unix(1700000600, 0), errors.New("fetch failed"))
+	m.Dump(1024, 3)
+	handler := m.Instrument(`/guild/{guildName}"\`, http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		wr.WriteHeader(http.StatusNotFound)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != EXPOSITION_CONTENT_TYPE {
+		t.Errorf("Content-Type %v", ct)
+	}
+	samples := checkExposition(t, rec.Body.String())
+
+	for series, want := range map[string]string{
+		`herald_updates_total{result="success"}`:                                                   "1",
+		`herald_updates_total{result="failure"}`:                                                   "1",
+		`herald_last_update_timestamp_seconds`:                                                     "1.7000006e+09",
+		`herald_last_successful_update_timestamp_seconds`:                                          "1.7e+09",
+		`herald_update_stage_duration_seconds_count{stage="load"}`:                                 "1",
+		`herald_dump_size_bytes`:                                                                   "1024",
+		`herald_http_requests_total{endpoint="/guild/{guildName}\"\\",code="404"}`:                 "1",
+		`herald_http_request_duration_seconds_bucket{endpoint="/guild/{guildName}\"\\",le="+Inf"}`: "1",
+	} {
+		if got, ok := samples[series]; !ok || got != want {
+			t.Errorf("%v = %q, want %v", series, got, want)
+		}
+	}
+
+	var buf bytes.Buffer
+	NewMetrics().Expose(&buf)
+	checkExposition(t, buf.String())
+}
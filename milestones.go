@@ -0,0 +1,442 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	EventLevel       = "level"
+	EventRealmRank   = "realmrank"
+	EventCharacterRP = "characterrp"
+	EventGuildRP     = "guildrp"
+
+	// the event log keeps at most MAX_EVENTS events of the last
+	// EVENT_RETENTION
+	MAX_EVENTS      = 10000
+	EVENT_RETENTION = 90 * 24 * time.Hour
+)
+
+// MAX_REALM_RANK is the highest realm rank of the realm point table.
+const MAX_REALM_RANK = 11
+
+// RealmPoints returns the realm points needed to reach rank, e.g. 7125 for
+// 2L0 and 8208750 for 11L0. Realm level l, counted from 1L0, costs
+// 25/3 l³ - 25/2 l² + 25/6 l realm points.
+func RealmPoints(rank int) uint64 {
+	if rank <= 1 {
+		return 0
+	}
+	l := uint64(rank-1) * 10
+	return 25 * (l - 1) * l * (2*l - 1) / 6
+}
+
+// RealmRankOf returns the realm rank, without the level, of a character
+// with rp realm points.
+func RealmRankOf(rp uint64) uint64 {
+	rank := 1
+	for rank < MAX_REALM_RANK && RealmPoints(rank+1) <= rp {
+		rank += 1
+	}
+	return uint64(rank)
+}
+
+// MilestoneConfig holds the thresholds that trigger an event once they are
+// crossed. Realm ranks are derived from the RP of a character with
+// RealmRankOf.
+type MilestoneConfig struct {
+	Levels      []uint64
+	RealmRanks  []uint64
+	CharacterRP []uint64
+	GuildRP     []uint64
+}
+
+var DefaultMilestoneConfig = MilestoneConfig{
+	Levels:      []uint64{50},
+	RealmRanks:  []uint64{2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	CharacterRP: []uint64{1000000, 2000000, 3000000, 5000000},
+	GuildRP:     []uint64{1000000, 5000000, 10000000, 25000000, 50000000, 100000000},
+}
+
+// LoadMilestoneConfig reads the thresholds from a JSON file, missing
+// thresholds are taken from DefaultMilestoneConfig.
+func LoadMilestoneConfig(filename string) MilestoneConfig {
+	config := DefaultMilestoneConfig
+	bytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Println(err)
+		}
+		return config
+	}
+	if err := json.Unmarshal(bytes, &config); err != nil {
+		log.Printf("Failed to parse %v: %v", filename, err)
+		return DefaultMilestoneConfig
+	}
+	return config
+}
+
+type Event struct {
+	Type      string
+	Timestamp time.Time
+	Character string `json:",omitempty"`
+	Guild     string `json:",omitempty"`
+	Realm     string `json:",omitempty"`
+	Class     string `json:",omitempty"`
+	Threshold uint64
+	Value     uint64
+}
+
+type EventFilter struct {
+	Type      string
+	Realm     string
+	Guild     string
+	Class     string
+	Character string
+	Since     time.Time
+}
+
+func (f *EventFilter) Match(e *Event) bool {
+	return (f.Type == "" || f.Type == e.Type) &&
+		(f.Realm == "" || f.Realm == e.Realm) &&
+		(f.Guild == "" || f.Guild == e.Guild) &&
+		(f.Class == "" || f.Class == e.Class) &&
+		(f.Character == "" || f.Character == e.Character) &&
+		e.Timestamp.After(f.Since)
+}
+
+type characterMilestones struct {
+	Level uint64
+	Rp    uint64
+}
+
+// MilestoneState holds the values the thresholds were last evaluated
+// against, it is persisted so that milestones crossed across a restart are
+// not lost.
+type MilestoneState struct {
+	Timestamp  time.Time
+	Characters map[string]characterMilestones // key: character name
+	Guilds     map[string]uint64              // key: guild name, value: RP
+}
+
+func NewMilestoneState(stats *Statistics, now time.Time) *MilestoneState {
+	state := &MilestoneState{
+		Timestamp:  now,
+		Characters: make(map[string]characterMilestones, len(stats.Characters)),
+		Guilds:     make(map[string]uint64, len(stats.Guilds)),
+	}
+	for name, char := range stats.Characters {
+		state.Characters[name] = characterMilestones{
+			Level: uint64(char.Level),
+			Rp:    char.Rp,
+		}
+	}
+	for name, guild := range stats.Guilds {
+		state.Guilds[name] = guild.RP
+	}
+	return state
+}
+
+func OpenMilestoneState(filename string) *MilestoneState {
+	fh, err := os.Open(filename)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Println(err)
+		}
+		return nil
+	}
+	defer fh.Close()
+
+	gReader, err := gzip.NewReader(fh)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	defer gReader.Close()
+
+	state := &MilestoneState{}
+	if err := json.NewDecoder(gReader).Decode(state); err != nil {
+		log.Printf("Failed to parse %v: %v", filename, err)
+		return nil
+	}
+	return state
+}
+
+func (s *MilestoneState) Save(filename string) error {
+	os.MkdirAll(filepath.Dir(filename), os.ModePerm)
+	// write to a temporary file first, a partial state would be worse than
+	// an old one
+	fh, err := ioutil.TempFile(filepath.Dir(filename), ".milestones")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(fh.Name())
+
+	gWriter := gzip.NewWriter(fh)
+	err = json.NewEncoder(gWriter).Encode(s)
+	if closeErr := gWriter.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := fh.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(fh.Name(), filename)
+}
+
+// Milestones evaluates the configured thresholds between two snapshots and
+// keeps a log of the recent events, which is appended to a file.
+type Milestones struct {
+	Config        MilestoneConfig
+	filename      string
+	stateFilename string
+	lock          sync.RWMutex
+	events        []*Event // oldest first
+	written       int      // events in the file
+	state         *MilestoneState
+}
+
+func NewMilestones(config MilestoneConfig, filename, stateFilename string) *Milestones {
+	m := &Milestones{
+		Config:        config,
+		filename:      filename,
+		stateFilename: stateFilename,
+		events:        make([]*Event, 0),
+		state:         OpenMilestoneState(stateFilename),
+	}
+
+	fh, err := os.Open(filename)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Println(err)
+		}
+		return m
+	}
+	defer fh.Close()
+
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		m.written += 1
+		e := &Event{}
+		if err := json.Unmarshal(scanner.Bytes(), e); err != nil {
+			log.Printf("Skipping corrupt event in %v: %v", filename, err)
+			continue
+		}
+		m.events = append(m.events, e)
+	}
+	if err := scanner.Err(); err != nil {
+		log.Println(err)
+	}
+	m.trim(time.Now())
+	return m
+}
+
+// crossed returns the highest threshold that lies in (prev, cur].
+func crossed(thresholds []uint64, prev, cur uint64) (threshold uint64, ok bool) {
+	for _, t := range thresholds {
+		if prev < t && t <= cur && t >= threshold {
+			threshold = t
+			ok = true
+		}
+	}
+	return
+}
+
+// Evaluate compares the new snapshot with the state of the last
+// evaluation, which it replaces, and returns the events for every
+// threshold crossed in between. All events are stamped with now, the time
+// of the snapshot. Characters and guilds that are new in cur are ignored.
+func (m *Milestones) Evaluate(cur *Statistics, now time.Time) []*Event {
+	events := make([]*Event, 0)
+	prev := m.state
+	m.state = NewMilestoneState(cur, now)
+	if prev == nil {
+		return events
+	}
+
+	for name, char := range cur.Characters {
+		old, ok := prev.Characters[name]
+		if !ok {
+			continue
+		}
+		checks := []struct {
+			Type       string
+			Thresholds []uint64
+			Prev, Cur  uint64
+		}{
+			{EventLevel, m.Config.Levels, old.Level, uint64(char.Level)},
+			{EventRealmRank, m.Config.RealmRanks, RealmRankOf(old.Rp), RealmRankOf(char.Rp)},
+			{EventCharacterRP, m.Config.CharacterRP, old.Rp, char.Rp},
+		}
+		for _, check := range checks {
+			if threshold, ok := crossed(check.Thresholds, check.Prev, check.Cur); ok {
+				events = append(events, &Event{
+					Type:      check.Type,
+					Timestamp: now,
+					Character: char.Name,
+					Guild:     char.Guild,
+					Realm:     char.Realm,
+					Class:     char.Class,
+					Threshold: threshold,
+					Value:     check.Cur,
+				})
+			}
+		}
+	}
+
+	for guildName, guild := range cur.Guilds {
+		if guildName == "" {
+			continue
+		}
+		oldRP, ok := prev.Guilds[guildName]
+		if !ok {
+			continue
+		}
+		if threshold, ok := crossed(m.Config.GuildRP, oldRP, guild.RP); ok {
+			e := &Event{
+				Type:      EventGuildRP,
+				Timestamp: now,
+				Guild:     guildName,
+				Threshold: threshold,
+				Value:     guild.RP,
+			}
+			for _, char := range cur.ByGuild[guildName].Characters {
+				e.Realm = char.Realm
+				break
+			}
+			events = append(events, e)
+		}
+	}
+
+	sort.Slice(events, func(a, b int) bool {
+		if events[a].Type != events[b].Type {
+			return events[a].Type < events[b].Type
+		}
+		return events[a].Character+"/"+events[a].Guild < events[b].Character+"/"+events[b].Guild
+	})
+	return events
+}
+
+// SaveState persists the state of the last evaluation.
+func (m *Milestones) SaveState() error {
+	if m.state == nil {
+		return nil
+	}
+	return m.state.Save(m.stateFilename)
+}
+
+// trim drops the events that are older than EVENT_RETENTION or beyond
+// MAX_EVENTS. The caller must hold the lock.
+func (m *Milestones) trim(now time.Time) {
+	cutoff := now.Add(-1 * EVENT_RETENTION)
+	i := sort.Search(len(m.events), func(i int) bool {
+		return m.events[i].Timestamp.After(cutoff)
+	})
+	i = max(i, len(m.events)-MAX_EVENTS)
+	if i > 0 {
+		m.events = append(make([]*Event, 0, len(m.events)-i), m.events[i:]...)
+	}
+}
+
+// rewrite replaces the file with the events that are kept. The caller must
+// hold the lock.
+func (m *Milestones) rewrite() error {
+	fh, err := ioutil.TempFile(filepath.Dir(m.filename), ".events")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(fh.Name())
+
+	w := bufio.NewWriter(fh)
+	encoder := json.NewEncoder(w)
+	for _, e := range m.events {
+		if err = encoder.Encode(e); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := fh.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(fh.Name(), m.filename)
+	}
+	if err != nil {
+		return err
+	}
+	m.written = len(m.events)
+	return nil
+}
+
+// Append adds events to the log and persists them. Once the file holds
+// twice as many events as the log may keep it is rewritten.
+func (m *Milestones) Append(events []*Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.events = append(m.events, events...)
+	m.trim(time.Now())
+
+	os.MkdirAll(filepath.Dir(m.filename), os.ModePerm)
+	if m.written+len(events) > 2*MAX_EVENTS {
+		return m.rewrite()
+	}
+	fh, err := os.OpenFile(m.filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	encoder := json.NewEncoder(fh)
+	for _, e := range events {
+		if err := encoder.Encode(e); err != nil {
+			return err
+		}
+		m.written += 1
+	}
+	return nil
+}
+
+// Events returns up to limit matching events, newest first.
+func (m *Milestones) Events(filter EventFilter, limit int) []*Event {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	results := make([]*Event, 0)
+	for i := len(m.events) - 1; i >= 0 && len(results) < limit; i-- {
+		if filter.Match(m.events[i]) {
+			results = append(results, m.events[i])
+		}
+	}
+	return results
+}
+
+// UpdateMilestones records the events since the last evaluated snapshot.
+// The events are saved before the state, so a crash in between repeats
+// events rather than losing them.
+func UpdateMilestones(cur *Statistics, now time.Time) []*Event {
+	log.Println("Evaluating milestones")
+	events := milestones.Evaluate(cur, now)
+	if err := milestones.Append(events); err != nil {
+		log.Printf("Failed to save events: %v", err)
+	}
+	if err := milestones.SaveState(); err != nil {
+		log.Printf("Failed to save milestone state: %v", err)
+	}
+	log.Printf("Done, %v new events", len(events))
+	return events
+}
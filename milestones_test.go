@@ -0,0 +1,138 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMilestonesAcrossRestart(t *testing.T) {
+	dir := t.TempDir()
+	events := filepath.Join(dir, "events.json")
+	state := filepath.Join(dir, "milestones.json.gz")
+	t0 := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	snapshot := func(rp uint64) *Statistics {
+		return LoadCharacters(map[string]*Character{
+			"Alice": {Name: "Alice", Guild: "Foo", Rp: rp, Level: 50},
+		})
+	}
+
+	m := NewMilestones(DefaultMilestoneConfig, events, state)
+	if got := m.Evaluate(snapshot(990000), t0); len(got) != 0 {
+		t.Fatalf("first evaluation returned %v events", len(got))
+	}
+	if err := m.SaveState(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the threshold is crossed while the server is down
+	m = NewMilestones(DefaultMilestoneConfig, events, state)
+	got := m.Evaluate(snapshot(1010000), t0.Add(time.Hour))
+	if len(got) != 2 {
+		t.Fatalf("got %v events after the restart, want a character and a guild event", len(got))
+	}
+	for _, e := range got {
+		if e.Threshold != 1000000 || !e.Timestamp.Equal(t0.Add(time.Hour)) {
+			t.Errorf("unexpected event %+v", e)
+		}
+	}
+}
+
+func TestMilestonesRetention(t *testing.T) {
+	dir := t.TempDir()
+	events := filepath.Join(dir, "events.json")
+	m := NewMilestones(DefaultMilestoneConfig, events, filepath.Join(dir, "milestones.json.gz"))
+
+	now := time.Now()
+	old := &Event{Type: EventLevel, Timestamp: now.Add(-2 * EVENT_RETENTION)}
+	if err := m.Append([]*Event{old}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(m.Events(EventFilter{}, MAX_EVENTS)); n != 0 {
+		t.Errorf("%v events beyond the retention are kept", n)
+	}
+
+	for i := 0; i < 3; i++ {
+		batch := make([]*Event, MAX_EVENTS)
+		for j := range batch {
+			batch[j] = &Event{Type: EventLevel, Timestamp: now}
+		}
+		if err := m.Append(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(m.events); n != MAX_EVENTS {
+		t.Errorf("%v events kept, want %v", n, MAX_EVENTS)
+	}
+
+	m = NewMilestones(DefaultMilestoneConfig, events, filepath.Join(dir, "milestones.json.gz"))
+	if m.written > 2*MAX_EVENTS {
+		t.Errorf("file holds %v events, want at most %v", m.written, 2*MAX_EVENTS)
+	}
+	if n := len(m.events); n != MAX_EVENTS {
+		t.Errorf("%v events loaded, want %v", n, MAX_EVENTS)
+	}
+}
+
+func TestRealmRankOf(t *testing.T) {
+	for _, c := range []struct {
+		rank int
+		rp   uint64
+	}{
+		{1, 0},
+		{2, 7125},
+		{3, 61750},
+		{4, 213875},
+		{5, 513500},
+		{10, 5974125},
+		{11, 8208750},
+	} {
+		if got := RealmPoints(c.rank); got != c.rp {
+			t.Errorf("RealmPoints(%v) = %v, want %v", c.rank, got, c.rp)
+		}
+	}
+	for _, c := range []struct {
+		rp   uint64
+		rank uint64
+	}{
+		{0, 1},
+		{7124, 1},
+		{7125, 2},
+		{61749, 2},
+		{61750, 3},
+		{8208749, 10},
+		{8208750, 11},
+		{100000000, MAX_REALM_RANK},
+	} {
+		if got := RealmRankOf(c.rp); got != c.rank {
+			t.Errorf("RealmRankOf(%v) = %v, want %v", c.rp, got, c.rank)
+		}
+	}
+}
+
+func TestMilestonesRealmRank(t *testing.T) {
+	dir := t.TempDir()
+	t0 := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	config := MilestoneConfig{RealmRanks: DefaultMilestoneConfig.RealmRanks}
+	m := NewMilestones(config, filepath.Join(dir, "events.json"), filepath.Join(dir, "milestones.json.gz"))
+	snapshot := func(rp uint64) *Statistics {
+		return LoadCharacters(map[string]*Character{
+			"Alice": {Name: "Alice", Rp: rp},
+		})
+	}
+
+	m.Evaluate(snapshot(RealmPoints(3)-1), t0)
+	if got := m.Evaluate(snapshot(RealmPoints(3)-1), t0.Add(time.Hour)); len(got) != 0 {
+		t.Errorf("events without a rank change: %+v", got)
+	}
+	got := m.Evaluate(snapshot(RealmPoints(3)), t0.Add(2*time.Hour))
+	if len(got) != 1 || got[0].Type != EventRealmRank || got[0].Threshold != 3 || got[0].Value != 3 {
+		t.Fatalf("crossing into 3L0: %+v", got)
+	}
+	// several ranks at once are reported as the highest one
+	got = m.Evaluate(snapshot(RealmPoints(5)+20000), t0.Add(3*time.Hour))
+	if len(got) != 1 || got[0].Threshold != 5 {
+		t.Fatalf("crossing into rank 5: %+v", got)
+	}
+}
@@ -1,6 +1,12 @@
 package main
 
-import "sort"
+import (
+	"sort"
+	"time"
+
+	"github.com/andir/UthgardCommunityHeraldBackend/search"
+	radix "github.com/armon/go-radix"
+)
 
 type CharactersByRP []*Character
 
@@ -58,6 +64,7 @@ type Query struct {
 	TotalXP    uint64
 	LWRP       int64
 	LWXP       int64
+	Activity   ActivityCounts
 	//	SortedByLWRP []*Character
 }
 
@@ -96,6 +103,20 @@ type Guild struct {
 
 type Statistics struct {
 	Query
+	// identifies the snapshot, derived from Fetched
+	Generation  int64
+	Fetched     time.Time
+	LastUpdated time.Time // newest LastUpdated of all characters
+
+	Names *Resolver
+
+	// built by BuildSearch before the snapshot is published
+	CharacterTree  *radix.Tree
+	GuildTree      *radix.Tree
+	CharacterIndex *search.Index
+	GuildIndex     *search.Index
+	ClassRaceIndex *search.Index
+
 	ByRealm map[string]*Query // key: realm
 	ByClass map[string]*Query // key: class
 	ByGuild map[string]*Query // key: guild name
@@ -109,6 +130,10 @@ type Statistics struct {
 	LWRPCharacters CharactersByLWRP
 	LWXPCharacters CharactersByLWXP
 
+	RealmsOverview *RealmsOverview
+	ClassBalance   map[string]*ClassBalance // key: class
+	Movers         map[string]*MoversWindow // key: window
+
 	Guilds map[string]*Guild
 }
 
@@ -127,6 +152,8 @@ type Character struct {
 	LastWeekRp       int64
 	LastWeekXp       int64
 	LastUpdated      int64
+	LastActive       int64
+	Activity         string
 }
 
 func LoadCharacters(characters map[string]*Character) *Statistics {
@@ -140,6 +167,7 @@ func LoadCharacters(characters map[string]*Character) *Statistics {
 	}
 
 	s.Query.FromCharacters(characters)
+	s.Names = NewResolver(characters)
 
 	byRealm := make(map[string]map[string]*Character)
 	byClass := make(map[string]map[string]*Character)
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andir/UthgardCommunityHeraldBackend/timeseries"
+)
+
+const (
+	MAX_MOVERS_WINDOW = 365 * 24 * time.Hour
+	// number of custom windows kept per snapshot
+	MAX_CUSTOM_MOVERS = 16
+)
+
+// the windows precomputed on every update
+var moverWindows = []string{"24h", "7d", "30d"}
+
+type WindowMover struct {
+	Name         string
+	Guild        string `json:",omitempty"`
+	Realm        string `json:",omitempty"`
+	Class        string `json:",omitempty"`
+	RP           int64
+	Rank         int
+	PreviousRP   int64
+	PreviousRank int
+	// positive if the entry moved up compared to the previous period
+	RankChange int
+}
+
+// MoversWindow holds the RP gained within a window and the window before
+// it for every character, guild, class and realm. Ranks are assigned by
+// Top since they depend on the filter.
+type MoversWindow struct {
+	Window     string
+	Since      time.Time
+	Until      time.Time
+	Characters []*WindowMover
+	Guilds     []*WindowMover
+	Classes    []*WindowMover
+	Realms     []*WindowMover
+}
+
+// parseWindow accepts Go durations and a number of days like "30d".
+func parseWindow(window string) (time.Duration, error) {
+	var d time.Duration
+	var err error
+	if strings.HasSuffix(window, "d") {
+		var days int
+		days, err = strconv.Atoi(strings.TrimSuffix(window, "d"))
+		d = time.Duration(days) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(window)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 || d > MAX_MOVERS_WINDOW {
+		return 0, errors.New("window out of range")
+	}
+	return d, nil
+}
+
+// ComputeMovers calculates the movers for several windows at once, every
+// series is only read once.
+func ComputeMovers(stats *Statistics, windows []string, until time.Time) ([]*MoversWindow, error) {
+	results := make([]*MoversWindow, len(windows))
+	durations := make([]time.Duration, len(windows))
+	for i, window := range windows {
+		d, err := parseWindow(window)
+		if err != nil {
+			return nil, err
+		}
+		durations[i] = d
+		results[i] = &MoversWindow{
+			Window:     window,
+			Since:      until.Add(-1 * d),
+			Until:      until,
+			Characters: make([]*WindowMover, 0),
+			Guilds:     make([]*WindowMover, 0),
+			Classes:    make([]*WindowMover, 0),
+			Realms:     make([]*WindowMover, 0),
+		}
+	}
+
+	gains := func(ts *timeseries.TimeSeries, template WindowMover, add func(*MoversWindow, *WindowMover)) {
+		if ts == nil {
+			return
+		}
+		for i, d := range durations {
+			m := template
+			m.RP = ts.ValueBetween(until.Add(-1*d), until)
+			m.PreviousRP = ts.ValueBetween(until.Add(-2*d), until.Add(-1*d))
+			if m.RP == 0 && m.PreviousRP == 0 {
+				continue
+			}
+			add(results[i], &m)
+		}
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(4)
+	go func() {
+		for characterName, char := range stats.Characters {
+			gains(timeseries.CharacterRPTimeSeries(characterName), WindowMover{
+				Name:  char.Name,
+				Guild: char.Guild,
+				Realm: char.Realm,
+				Class: char.Class,
+			}, func(w *MoversWindow, m *WindowMover) { w.Characters = append(w.Characters, m) })
+		}
+		wg.Done()
+	}()
+	go func() {
+		for guildName, query := range stats.ByGuild {
+			if guildName == "" {
+				continue
+			}
+			template := WindowMover{Name: guildName}
+			for _, char := range query.Characters {
+				template.Realm = char.Realm
+				break
+			}
+			gains(timeseries.GuildRPTimeSeries(guildName), template,
+				func(w *MoversWindow, m *WindowMover) { w.Guilds = append(w.Guilds, m) })
+		}
+		wg.Done()
+	}()
+	go func() {
+		for className, query := range stats.ByClass {
+			template := WindowMover{Name: className, Class: className}
+			for _, char := range query.Characters {
+				template.Realm = char.Realm
+				break
+			}
+			gains(timeseries.ClassRPTimeSeries(className), template,
+				func(w *MoversWindow, m *WindowMover) { w.Classes = append(w.Classes, m) })
+		}
+		wg.Done()
+	}()
+	go func() {
+		for realmName := range stats.ByRealm {
+			gains(timeseries.RealmRPTimeSeries(realmName), WindowMover{Name: realmName, Realm: realmName},
+				func(w *MoversWindow, m *WindowMover) { w.Realms = append(w.Realms, m) })
+		}
+		wg.Done()
+	}()
+	wg.Wait()
+
+	return results, nil
+}
+
+// Top ranks the entries matching realm and class (empty matches all) for
+// both periods and returns the first limit of them. Guilds and realms
+// aren't filtered by class.
+func (w *MoversWindow) Top(entries []*WindowMover, realm, class string, limit int) []WindowMover {
+	filtered := make([]WindowMover, 0)
+	for _, m := range entries {
+		if (realm == "" || m.Realm == realm) && (class == "" || m.Class == "" || m.Class == class) {
+			filtered = append(filtered, *m)
+		}
+	}
+
+	sort.SliceStable(filtered, func(a, b int) bool { return filtered[a].PreviousRP > filtered[b].PreviousRP })
+	for i := range filtered {
+		filtered[i].PreviousRank = 0
+		if filtered[i].PreviousRP > 0 {
+			filtered[i].PreviousRank = i + 1
+		}
+	}
+	sort.SliceStable(filtered, func(a, b int) bool { return filtered[a].RP > filtered[b].RP })
+	n := sort.Search(len(filtered), func(i int) bool { return filtered[i].RP <= 0 })
+	filtered = filtered[:n]
+	for i := range filtered {
+		m := &filtered[i]
+		m.Rank = i + 1
+		if m.PreviousRank > 0 {
+			m.RankChange = m.PreviousRank - m.Rank
+		}
+	}
+
+	return filtered[:min(limit, len(filtered))]
+}
+
+// UpdateMovers precomputes the movers of the standard windows.
+func UpdateMovers(stats *Statistics) {
+	log.Println("Calculating movers")
+	windows, err := ComputeMovers(stats, moverWindows, stats.Fetched)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	stats.Movers = make(map[string]*MoversWindow)
+	for _, w := range windows {
+		stats.Movers[w.Window] = w
+	}
+	log.Println("Done")
+}
+
+// bucketWindow rounds a window up to whole hours below two days and to
+// whole days above, so that only a limited number of distinct custom
+// windows exist. The name is the one the window is cached by.
+func bucketWindow(d time.Duration) string {
+	day := 24 * time.Hour
+	if d < 2*day {
+		return strconv.Itoa(int((d+time.Hour-1)/time.Hour)) + "h"
+	}
+	return strconv.Itoa(int((d+day-1)/day)) + "d"
+}
+
+type customMoversWindow struct {
+	done   chan bool // closed once window and err are set
+	window *MoversWindow
+	err    error
+}
+
+// customMovers caches the custom windows of the current snapshot. Every
+// window is computed once, concurrent requests for it wait for the first.
+var customMovers struct {
+	lock       sync.Mutex
+	generation int64
+	windows    map[string]*customMoversWindow
+	order      []string // oldest first
+}
+
+// MoversFor returns the movers for any window. The precomputed windows are
+// served from the snapshot, others are bucketed by bucketWindow and
+// calculated once per snapshot.
+func MoversFor(stats *Statistics, window string) (*MoversWindow, error) {
+	if w, ok := stats.Movers[window]; ok {
+		return w, nil
+	}
+	d, err := parseWindow(window)
+	if err != nil {
+		return nil, err
+	}
+	window = bucketWindow(d)
+	if w, ok := stats.Movers[window]; ok {
+		return w, nil
+	}
+
+	customMovers.lock.Lock()
+	if customMovers.generation != stats.Generation || customMovers.windows == nil {
+		customMovers.generation = stats.Generation
+		customMovers.windows = make(map[string]*customMoversWindow)
+		customMovers.order = nil
+	}
+	c, ok := customMovers.windows[window]
+	if !ok {
+		c = &customMoversWindow{done: make(chan bool)}
+		customMovers.windows[window] = c
+		customMovers.order = append(customMovers.order, window)
+		if len(customMovers.order) > MAX_CUSTOM_MOVERS {
+			delete(customMovers.windows, customMovers.order[0])
+			customMovers.order = customMovers.order[1:]
+		}
+	}
+	customMovers.lock.Unlock()
+
+	if ok {
+		<-c.done
+		return c.window, c.err
+	}
+	windows, err := ComputeMovers(stats, []string{window}, stats.Fetched)
+	if err == nil {
+		c.window = windows[0]
+	}
+	c.err = err
+	close(c.done)
+	return c.window, c.err
+}
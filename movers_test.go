@@ -0,0 +1,141 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andir/UthgardCommunityHeraldBackend/timeseries"
+)
+
+func TestComputeMovers(t *testing.T) {
+	t.Chdir(t.TempDir())
+	now := time.Date(2026, time.January, 10, 0, 0, 0, 0, time.UTC)
+
+	stats := LoadCharacters(map[string]*Character{
+		"Alice": {Name: "Alice", Realm: "Albion"},
+		"Bob":   {Name: "Bob", Realm: "Albion"},
+	})
+	// updated once per window, must not show up with its lifetime RP
+	writeSeries(t, timeseries.TimeSeriesPath("character", "Alice", "rp"), map[time.Time]uint64{
+		now.Add(-72 * time.Hour): 2000000,
+		now.Add(-2 * time.Hour):  2000500,
+	})
+	writeSeries(t, timeseries.TimeSeriesPath("character", "Bob", "rp"), map[time.Time]uint64{
+		now.Add(-50 * time.Hour): 1000,
+		now.Add(-30 * time.Hour): 1800,
+		now.Add(-20 * time.Hour): 2000,
+		now.Add(-1 * time.Hour):  2600,
+	})
+
+	windows, err := ComputeMovers(stats, []string{"24h"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	top := windows[0].Top(windows[0].Characters, "", "", 10)
+	want := []struct {
+		name             string
+		rp, previousRP   int64
+		rank, rankChange int
+	}{
+		{"Bob", 800, 800, 1, 0},
+		{"Alice", 500, 0, 2, 0},
+	}
+	if len(top) != len(want) {
+		t.Fatalf("got %+v", top)
+	}
+	for i, w := range want {
+		m := top[i]
+		if m.Name != w.name || m.RP != w.rp || m.PreviousRP != w.previousRP || m.Rank != w.rank || m.RankChange != w.rankChange {
+			t.Errorf("rank %v: got %+v, want %+v", i+1, m, w)
+		}
+	}
+}
+
+func TestBucketWindow(t *testing.T) {
+	for _, c := range []struct {
+		window, want string
+	}{
+		{"24h", "24h"},
+		{"90m", "2h"},
+		{"47h", "47h"},
+		{"48h", "2d"},
+		{"50h", "3d"},
+		{"168h", "7d"},
+		{"30d", "30d"},
+	} {
+		d, err := parseWindow(c.window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := bucketWindow(d); got != c.want {
+			t.Errorf("bucketWindow(%v) = %v, want %v", c.window, got, c.want)
+		}
+	}
+}
+
+func TestMoversFor(t *testing.T) {
+	t.Chdir(t.TempDir())
+	now := time.Date(2026, time.January, 10, 0, 0, 0, 0, time.UTC)
+	stats := LoadCharacters(map[string]*Character{
+		"Alice": {Name: "Alice", Realm: "Albion"},
+	})
+	stats.Generation, stats.Fetched = 1, now
+	writeSeries(t, timeseries.TimeSeriesPath("character", "Alice", "rp"), map[time.Time]uint64{
+		now.Add(-100 * time.Hour): 1000,
+		now.Add(-1 * time.Hour):   1500,
+	})
+	UpdateMovers(stats)
+
+	// precomputed windows don't wait for custom ones
+	customMovers.lock.Lock()
+	done := make(chan *MoversWindow)
+	go func() {
+		w, _ := MoversFor(stats, "168h")
+		done <- w
+	}()
+	select {
+	case w := <-done:
+		if w != stats.Movers["7d"] {
+			t.Errorf("168h was not served from the precomputed 7d window")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("precomputed window waited for the custom windows")
+	}
+	customMovers.lock.Unlock()
+
+	// concurrent requests of a bucket share one computation
+	results := make(chan *MoversWindow, 8)
+	for i := 0; i < cap(results); i++ {
+		window := []string{"50h", "3d", "72h", "60h"}[i%4]
+		go func() {
+			w, err := MoversFor(stats, window)
+			if err != nil {
+				t.Error(err)
+			}
+			results <- w
+		}()
+	}
+	first := <-results
+	for i := 1; i < cap(results); i++ {
+		if w := <-results; w != first {
+			t.Errorf("the 3d bucket was computed more than once")
+		}
+	}
+	if first.Window != "3d" {
+		t.Errorf("window %v, want 3d", first.Window)
+	}
+	if _, ok := stats.Movers["3d"]; ok {
+		t.Error("custom window was added to the published snapshot")
+	}
+
+	// a new snapshot starts with an empty cache
+	next := *stats
+	next.Generation = 2
+	if w, _ := MoversFor(&next, "3d"); w == first {
+		t.Error("custom window of the previous snapshot was served")
+	}
+
+	if _, err := MoversFor(stats, "-3d"); err == nil {
+		t.Error("negative window accepted")
+	}
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andir/UthgardCommunityHeraldBackend/timeseries"
+)
+
+type Endpoint struct {
+	Endpoint string
+	Func     APIFunction
+	Doc      APIDoc
+}
+
+type APIParam struct {
+	Name        string
+	Description string
+}
+
+// APIDoc describes an endpoint for the OpenAPI document. Response and
+// Body are sample values, their schemas are derived by reflection.
+type APIDoc struct {
+	Summary     string
+	Methods     []string // defaults to GET
+	Query       []APIParam
+	Body        interface{}
+	Response    interface{}
+	ContentType string // defaults to application/json
+}
+
+var pathParams = map[string]string{
+	"characterName": "Name of the character, case insensitive",
+	"guildName":     "Name of the guild, case insensitive",
+	"realmName":     "Name of the realm, case insensitive",
+	"className":     "Name of the class, case insensitive",
+	"webhookID":     "ID returned when the webhook was registered",
+	"kind":          "One of characters, guilds, classes or realms",
+}
+
+var (
+	sinceParam  = APIParam{"since", "Start of the window: a duration like 72h, a unix timestamp or an RFC 3339 date"}
+	limitParam  = APIParam{"limit", "Maximum number of results"}
+	realmParam  = APIParam{"realm", "Only include entries of this realm"}
+	classParam  = APIParam{"class", "Only include entries of this class"}
+	formatParam = APIParam{"format", "One of json, csv or ndjson, defaults to the Accept header"}
+)
+
+type topRPSample []struct {
+	Name  string
+	Guild string
+	Rp    uint64
+}
+
+type topXPSample []struct {
+	Name  string
+	Guild string
+	Xp    uint64
+}
+
+type moversSample struct {
+	Window string
+	Since  time.Time
+	Until  time.Time
+	Movers []WindowMover
+}
+
+func historyDoc(what string) APIDoc {
+	return APIDoc{Summary: what + " over time", Response: timeseries.TimeSeries{}}
+}
+
+// schemaGenerator derives JSON schemas from Go types. Named structs are
+// collected as components and referenced. With v1 set the fields are named
+// like the versioned API names them.
+type schemaGenerator struct {
+	components map[string]interface{}
+	v1         bool
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (g *schemaGenerator) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name := t.Name()
+		if g.v1 {
+			name = "v1" + name
+		}
+		if _, ok := g.components[name]; !ok {
+			// register first, types may refer to themselves
+			g.components[name] = nil
+			g.components[name] = g.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	// interfaces can be anything
+	return map[string]interface{}{}
+}
+
+func (g *schemaGenerator) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var collect func(t reflect.Type)
+	collect = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := f.Name
+			if tag := f.Tag.Get("json"); tag != "" {
+				if tag == "-" {
+					continue
+				}
+				if n := strings.Split(tag, ",")[0]; n != "" {
+					name = n
+				}
+			}
+			if f.Anonymous && f.Tag.Get("json") == "" {
+				ft := f.Type
+				if ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				if ft.Kind() == reflect.Struct {
+					collect(ft)
+					continue
+				}
+			}
+			if f.PkgPath != "" {
+				continue
+			}
+			if g.v1 {
+				name = lowerCamel(name)
+			}
+			properties[name] = g.schema(f.Type)
+		}
+	}
+	collect(t)
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+var pathParamPattern = regexp.MustCompile(`{([^}]+)}`)
+
+var paginationParams = []APIParam{
+	{"offset", "Number of list entries to skip"},
+	{"limit", "Maximum number of list entries, defaults to " + strconv.Itoa(V1_PAGE_SIZE)},
+}
+
+// operations documents the methods of an endpoint. Versioned endpoints
+// wrap their response in the envelope and are paginated.
+func (g *schemaGenerator) operations(endpoint Endpoint) map[string]interface{} {
+	doc := endpoint.Doc
+	parameters := make([]interface{}, 0)
+	for _, match := range pathParamPattern.FindAllStringSubmatch(endpoint.Endpoint, -1) {
+		parameters = append(parameters, map[string]interface{}{
+			"name":        match[1],
+			"in":          "path",
+			"required":    true,
+			"description": pathParams[match[1]],
+			"schema":      map[string]interface{}{"type": "string"},
+		})
+	}
+	query := make([]APIParam, 0, len(doc.Query)+3)
+	for _, param := range doc.Query {
+		// the limit of versioned endpoints is the one of the pagination
+		if g.v1 && param.Name == limitParam.Name {
+			continue
+		}
+		query = append(query, param)
+	}
+	if g.v1 {
+		query = append(query, paginationParams...)
+	}
+	_, exportable := exporters[endpoint.Endpoint]
+	if exportable {
+		query = append(query, formatParam)
+	}
+	for _, param := range query {
+		parameters = append(parameters, map[string]interface{}{
+			"name":        param.Name,
+			"in":          "query",
+			"description": param.Description,
+			"schema":      map[string]interface{}{"type": "string"},
+		})
+	}
+
+	contentType := doc.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	errorSchema := map[string]interface{}{"$ref": "#/components/schemas/Error"}
+	if g.v1 {
+		errorSchema = g.schema(reflect.TypeOf(Envelope{}))
+	}
+	response := map[string]interface{}{"description": "OK"}
+	if doc.Response != nil {
+		schema := g.schema(reflect.TypeOf(doc.Response))
+		if g.v1 {
+			envelope := g.object(reflect.TypeOf(Envelope{}))
+			envelope["properties"].(map[string]interface{})["data"] = schema
+			schema = envelope
+		}
+		content := map[string]interface{}{
+			contentType: map[string]interface{}{"schema": schema},
+		}
+		if exportable {
+			for _, t := range formatContentTypes {
+				content[strings.Split(t, ";")[0]] = map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+			}
+		}
+		response["content"] = content
+	}
+
+	path := endpoint.Endpoint
+	if g.v1 {
+		path = V1_PREFIX + path
+	}
+	methods := doc.Methods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet}
+	}
+	operations := make(map[string]interface{})
+	for _, method := range methods {
+		operation := map[string]interface{}{
+			"summary":     doc.Summary,
+			"operationId": strings.ToLower(method) + operationName(path),
+			"parameters":  parameters,
+			"responses": map[string]interface{}{
+				"200": response,
+				"400": map[string]interface{}{
+					"description": "Unknown entity or invalid parameters",
+					"content": map[string]interface{}{
+						"application/json": map[string]interface{}{"schema": errorSchema},
+					},
+				},
+			},
+		}
+		if doc.Body != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": g.schema(reflect.TypeOf(doc.Body))},
+				},
+			}
+		}
+		operations[strings.ToLower(method)] = operation
+	}
+	return operations
+}
+
+// NewOpenAPI generates an OpenAPI 3 document of the endpoints and their
+// versions below V1_PREFIX.
+func NewOpenAPI(endpoints []Endpoint) map[string]interface{} {
+	components := make(map[string]interface{})
+	g := &schemaGenerator{components: components}
+	v1 := &schemaGenerator{components: components, v1: true}
+	components["Error"] = g.object(reflect.TypeOf(struct{ Error string }{}))
+
+	paths := make(map[string]interface{})
+	for _, endpoint := range endpoints {
+		paths[endpoint.Endpoint] = g.operations(endpoint)
+		if endpoint.Func != nil {
+			paths[V1_PREFIX+endpoint.Endpoint] = v1.operations(endpoint)
+		}
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title": "Uthgard Community Herald",
+			"description": "Statistics of the characters, guilds, classes and realms of Uthgard.\n\n" +
+				"All endpoints are also available below " + V1_PREFIX + ". Their responses are wrapped in an envelope " +
+				"with the generation and timestamps of the snapshot, fields are named in lowerCamel case and lists " +
+				"are paginated by offset and limit.",
+			"version": "1.0",
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": components},
+	}
+}
+
+// operationName turns a path like /guild/{guildName}/history/rp into
+// GuildGuildNameHistoryRp.
+func operationName(path string) string {
+	name := ""
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/' || r == '{' || r == '}'
+	}) {
+		name += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return name
+}
+
+const explorerHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Uthgard Community Herald API</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+details { margin: 0.5em 0; border: 1px solid #ccc; padding: 0.5em; }
+summary { cursor: pointer; font-family: monospace; }
+label { display: block; margin: 0.2em 0; }
+pre { background: #f4f4f4; padding: 0.5em; max-height: 30em; overflow: auto; }
+</style>
+</head>
+<body>
+<h1>Uthgard Community Herald API</h1>
+<p>Generated from <a href="openapi.json">openapi.json</a>.</p>
+<div id="paths"></div>
+<script>
+fetch("openapi.json").then(r => r.json()).then(spec => {
+  const root = document.getElementById("paths");
+  Object.keys(spec.paths).sort().forEach(path => {
+    Object.entries(spec.paths[path]).forEach(([method, op]) => {
+      const el = document.createElement("details");
+      const title = document.createElement("summary");
+      title.textContent = method.toUpperCase() + " " + path + " - " + op.summary;
+      el.appendChild(title);
+      const inputs = {};
+      op.parameters.forEach(p => {
+        const label = document.createElement("label");
+        label.textContent = p.name + " (" + p.in + (p.description ? ", " + p.description : "") + ") ";
+        const input = document.createElement("input");
+        label.appendChild(input);
+        el.appendChild(label);
+        inputs[p.name] = [p, input];
+      });
+      let body;
+      if (op.requestBody) {
+        body = document.createElement("textarea");
+        body.rows = 6; body.cols = 60; body.value = "{}";
+        el.appendChild(body);
+      }
+      const button = document.createElement("button");
+      button.textContent = "Try";
+      const out = document.createElement("pre");
+      button.onclick = () => {
+        let url = path;
+        const query = new URLSearchParams();
+        Object.values(inputs).forEach(([p, input]) => {
+          if (p.in === "path") url = url.replace("{" + p.name + "}", encodeURIComponent(input.value));
+          else if (input.value) query.set(p.name, input.value);
+        });
+        if (query.toString()) url += "?" + query;
+        const init = {method: method.toUpperCase()};
+        if (body) init.body = body.value;
+        fetch(url, init).then(r => r.text()).then(t => {
+          try { t = JSON.stringify(JSON.parse(t), null, 2); } catch (e) {}
+          out.textContent = t;
+        });
+      };
+      el.appendChild(button);
+      el.appendChild(out);
+      root.appendChild(el);
+    });
+  });
+});
+</script>
+</body>
+</html>
+`
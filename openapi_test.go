@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNewOpenAPI(t *testing.T) {
+	endpoints := apiEndpoints()
+	spec := NewOpenAPI(endpoints)
+	paths := spec["paths"].(map[string]interface{})
+	components := spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+
+	for _, endpoint := range endpoints {
+		if endpoint.Doc.Summary == "" {
+			t.Errorf("%v is not documented", endpoint.Endpoint)
+		}
+		if _, ok := paths[endpoint.Endpoint]; !ok {
+			t.Errorf("%v is missing", endpoint.Endpoint)
+		}
+		_, ok := paths[V1_PREFIX+endpoint.Endpoint]
+		if served := endpoint.Func != nil; ok != served {
+			t.Errorf("%v%v documented: %v, served: %v", V1_PREFIX, endpoint.Endpoint, ok, served)
+		}
+	}
+
+	get := paths[V1_PREFIX+"/character/{characterName}"].(map[string]interface{})["get"].(map[string]interface{})
+	schema := get["responses"].(map[string]interface{})["200"].(map[string]interface{})["content"].(map[string]interface{})["application/json"].(map[string]interface{})["schema"].(map[string]interface{})
+	properties := schema["properties"].(map[string]interface{})
+	for _, name := range []string{"data", "generation", "fetched", "dumpTimestamp", "pagination"} {
+		if _, ok := properties[name]; !ok {
+			t.Errorf("envelope lacks %v", name)
+		}
+	}
+	if ref := properties["data"].(map[string]interface{})["$ref"]; ref != "#/components/schemas/v1Character" {
+		t.Fatalf("data refers to %v", ref)
+	}
+	character := components["v1Character"].(map[string]interface{})["properties"].(map[string]interface{})
+	if _, ok := character["rp"]; !ok {
+		t.Errorf("v1 character fields are not lowerCamel: %v", character)
+	}
+	if _, ok := components["Character"].(map[string]interface{})["properties"].(map[string]interface{})["Rp"]; !ok {
+		t.Errorf("legacy character fields were renamed")
+	}
+
+	parameters := map[string]int{}
+	for _, p := range paths[V1_PREFIX+"/events"].(map[string]interface{})["get"].(map[string]interface{})["parameters"].([]interface{}) {
+		parameters[p.(map[string]interface{})["name"].(string)]++
+	}
+	if parameters["offset"] != 1 || parameters["limit"] != 1 {
+		t.Errorf("v1 events parameters %v", parameters)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/andir/UthgardCommunityHeraldBackend/timeseries"
+)
+
+// the day ranks were last recorded for, ranks are only written once a day
+var lastRankDay time.Time
+
+// lastRankDay is kept in this file so a restart doesn't record a second set
+// of ranks for the same day
+var rankDayFile = filepath.Join("data", "ranks.json")
+
+func rankDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+func loadRankDay(filename string) time.Time {
+	var day time.Time
+	bytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Println(err)
+		}
+		return day
+	}
+	if err := json.Unmarshal(bytes, &day); err != nil {
+		log.Printf("Failed to parse %v: %v", filename, err)
+	}
+	return day
+}
+
+func saveRankDay(filename string, day time.Time) error {
+	bytes, err := json.Marshal(day)
+	if err != nil {
+		return err
+	}
+	os.MkdirAll(filepath.Dir(filename), os.ModePerm)
+	return ioutil.WriteFile(filename, bytes, 0644)
+}
+
+// UpdateRanks records the positions of every character on the global, realm
+// and class RP ladder and of every guild on the global and realm guild RP
+// ladder, once per day.
+func UpdateRanks(stats *Statistics, now time.Time) {
+	if now.IsZero() {
+		now = time.Now()
+	}
+	day := rankDay(now)
+	if lastRankDay.IsZero() {
+		lastRankDay = loadRankDay(rankDayFile)
+	}
+	if day.Equal(lastRankDay) {
+		return
+	}
+
+	log.Println("Updating rank timeseries...")
+	type Item struct {
+		metric string
+		value  int
+	}
+	save := func(queryType, name string, metrics []Item) {
+		for _, metric := range metrics {
+			path := timeseries.TimeSeriesPath(queryType, name, metric.metric)
+			err := timeseries.UpdateSeries(path, uint64(metric.value), day)
+			if err != nil {
+				log.Printf("failed to save TS for %v: %v", name, err)
+			}
+		}
+	}
+	ranks := func(query *Query) map[*Character]int {
+		r := make(map[*Character]int, len(query.SortedByRP))
+		for i, char := range query.SortedByRP {
+			r[char] = i + 1
+		}
+		return r
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		// series are keyed like the dump, not by the name the herald reports
+		names := make(map[*Character]string, len(stats.Characters))
+		for characterName, char := range stats.Characters {
+			names[char] = characterName
+		}
+		realmRanks := make(map[string]map[*Character]int)
+		for realmName, query := range stats.ByRealm {
+			realmRanks[realmName] = ranks(query)
+		}
+		classRanks := make(map[string]map[*Character]int)
+		for className, query := range stats.ByClass {
+			classRanks[className] = ranks(query)
+		}
+		for i, char := range stats.SortedByRP {
+			save("character", names[char], []Item{
+				{"rank", i + 1},
+				{"rank_realm", realmRanks[char.Realm][char]},
+				{"rank_class", classRanks[char.Class][char]},
+			})
+		}
+		wg.Done()
+	}()
+	go func() {
+		position := 0
+		realmPositions := make(map[string]int)
+		for _, guild := range stats.TopRPGuilds {
+			// characters without a guild
+			if guild.Name == "" {
+				continue
+			}
+			position += 1
+			realm := ""
+			for _, char := range stats.ByGuild[guild.Name].Characters {
+				realm = char.Realm
+				break
+			}
+			realmPositions[realm] += 1
+			save("guild", guild.Name, []Item{
+				{"rank", position},
+				{"rank_realm", realmPositions[realm]},
+			})
+		}
+		wg.Done()
+	}()
+	wg.Wait()
+
+	lastRankDay = day
+	if err := saveRankDay(rankDayFile, day); err != nil {
+		log.Printf("Failed to save %v: %v", rankDayFile, err)
+	}
+	log.Println("Done")
+}
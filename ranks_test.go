@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andir/UthgardCommunityHeraldBackend/timeseries"
+)
+
+func TestUpdateRanks(t *testing.T) {
+	t.Chdir(t.TempDir())
+	lastRankDay = time.Time{}
+	defer func() { lastRankDay = time.Time{} }()
+	now := time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+	day := rankDay(now)
+
+	stats := LoadCharacters(map[string]*Character{
+		"Alice": {Name: "Alice", Realm: "Albion", Class: "Cleric", Guild: "Avalon", Rp: 3000},
+		"Bob":   {Name: "Bob", Realm: "Albion", Class: "Wizard", Guild: "Avalon", Rp: 2000},
+		"Carol": {Name: "Carol", Realm: "Hibernia", Class: "Bard", Guild: "Tir", Rp: 2500},
+		// the series follow the dump key, not the name the herald reports
+		"Dave": {Name: "Dave the Bard", Realm: "Hibernia", Class: "Bard", Rp: 1000},
+	})
+	UpdateRanks(stats, now)
+
+	characters := []struct {
+		name               string
+		rank, realm, class uint64
+	}{
+		{"Alice", 1, 1, 1},
+		{"Carol", 2, 1, 1},
+		{"Bob", 3, 2, 1},
+		{"Dave", 4, 2, 2},
+	}
+	for _, c := range characters {
+		for metric, want := range map[string]uint64{"rank": c.rank, "rank_realm": c.realm, "rank_class": c.class} {
+			ts := timeseries.OpenTimeSeries(timeseries.TimeSeriesPath("character", c.name, metric))
+			if ts == nil {
+				t.Errorf("%v: no %v series", c.name, metric)
+				continue
+			}
+			if got, ok := ts.ValueAt(day); !ok || got != want {
+				t.Errorf("%v: %v = %v, want %v", c.name, metric, got, want)
+			}
+		}
+	}
+
+	guilds := map[string][2]uint64{"Avalon": {1, 1}, "Tir": {2, 1}}
+	for guild, want := range guilds {
+		if got, _ := timeseries.GuildRankTimeSeries(guild).ValueAt(day); got != want[0] {
+			t.Errorf("%v: rank = %v, want %v", guild, got, want[0])
+		}
+		if got, _ := timeseries.GuildRealmRankTimeSeries(guild).ValueAt(day); got != want[1] {
+			t.Errorf("%v: rank_realm = %v, want %v", guild, got, want[1])
+		}
+	}
+
+	// the day survives a restart, a second update of the day is skipped
+	lastRankDay = time.Time{}
+	stats.Characters["Bob"].Rp = 5000
+	stats = LoadCharacters(stats.Characters)
+	UpdateRanks(stats, now.Add(time.Hour))
+	if got, _ := timeseries.CharacterRankTimeSeries("Bob").ValueAt(day); got != 3 {
+		t.Errorf("ranks were recorded twice on %v", day)
+	}
+
+	// the next day is recorded
+	next := now.Add(24 * time.Hour)
+	UpdateRanks(stats, next)
+	if got, _ := timeseries.CharacterRankTimeSeries("Bob").ValueAt(rankDay(next)); got != 1 {
+		t.Errorf("Bob: rank = %v on the next day, want 1", got)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"github.com/andir/UthgardCommunityHeraldBackend/timeseries"
+)
+
+type RealmOverview struct {
+	Realm            string
+	RP               uint64
+	XP               uint64
+	RPShare          float64
+	Population       int
+	ActivePopulation int
+	RPPerDay         float64
+	Classes          map[string]int // key: class, value: number of characters
+}
+
+type RealmsOverview struct {
+	TotalRP uint64
+	TotalXP uint64
+	Realms  []*RealmOverview
+}
+
+// UpdateRealmsOverview compares all realms side by side. It has to run
+// after UpdateActivity.
+func UpdateRealmsOverview(stats *Statistics) {
+	log.Println("Calculating realms overview")
+	// the realm series are recorded at the time of the dump
+	week := stats.LastUpdated.Add(-1 * ACTIVE_WINDOW)
+
+	overview := &RealmsOverview{
+		TotalRP: stats.TotalRP,
+		TotalXP: stats.TotalXP,
+		Realms:  make([]*RealmOverview, 0, len(stats.ByRealm)),
+	}
+	for realmName, query := range stats.ByRealm {
+		realm := &RealmOverview{
+			Realm:            realmName,
+			RP:               query.TotalRP,
+			XP:               query.TotalXP,
+			Population:       len(query.Characters),
+			ActivePopulation: query.Activity.Active,
+			Classes:          make(map[string]int),
+		}
+		if stats.TotalRP > 0 {
+			realm.RPShare = 100 * float64(query.TotalRP) / float64(stats.TotalRP)
+		}
+		if ts := timeseries.RealmRPTimeSeries(realmName); ts != nil {
+			realm.RPPerDay = float64(ts.ValueBetween(week, stats.LastUpdated)) / ACTIVE_WINDOW.Hours() * 24
+		}
+		for _, char := range query.Characters {
+			realm.Classes[char.Class] += 1
+		}
+		overview.Realms = append(overview.Realms, realm)
+	}
+	sort.Slice(overview.Realms, func(a, b int) bool {
+		return overview.Realms[a].Realm < overview.Realms[b].Realm
+	})
+
+	stats.RealmsOverview = overview
+	log.Println("Done")
+}
+
+type RPShareEntry struct {
+	Share     float64
+	Timestamp time.Time
+}
+
+// RealmRPShareHistory returns the share of the total RP each realm held
+// over time. Only timestamps recorded for every realm are considered.
+func RealmRPShareHistory(realms []string) map[string][]RPShareEntry {
+	// timestamps are compared by their unix time since their locations
+	// differ once they went through JSON
+	values := make(map[int64]map[string]uint64)
+	found := 0
+	for _, realm := range realms {
+		ts := timeseries.RealmRPTimeSeries(realm)
+		if ts == nil {
+			continue
+		}
+		found += 1
+		for _, e := range ts.Entries {
+			v, ok := values[e.Timestamp.Unix()]
+			if !ok {
+				v = make(map[string]uint64)
+				values[e.Timestamp.Unix()] = v
+			}
+			v[realm] = e.Value
+		}
+	}
+
+	timestamps := make([]int64, 0, len(values))
+	for timestamp, v := range values {
+		if len(v) == found {
+			timestamps = append(timestamps, timestamp)
+		}
+	}
+	sort.Slice(timestamps, func(a, b int) bool { return timestamps[a] < timestamps[b] })
+
+	history := make(map[string][]RPShareEntry)
+	for _, timestamp := range timestamps {
+		var total uint64
+		for _, value := range values[timestamp] {
+			total += value
+		}
+		if total == 0 {
+			continue
+		}
+		for realm, value := range values[timestamp] {
+			history[realm] = append(history[realm], RPShareEntry{
+				Share:     100 * float64(value) / float64(total),
+				Timestamp: time.Unix(timestamp, 0),
+			})
+		}
+	}
+	return history
+}
+
+// class names are unique to a realm in DAoC, so the realm of a class can be
+// derived from any of its characters.
+func realmClasses(stats *Statistics) map[string][]string {
+	classes := make(map[string][]string)
+	for realmName, query := range stats.ByRealm {
+		seen := make(map[string]bool)
+		for _, char := range query.Characters {
+			if !seen[char.Class] {
+				seen[char.Class] = true
+				classes[realmName] = append(classes[realmName], char.Class)
+			}
+		}
+	}
+	return classes
+}
+
+// BackfillRealmXP repairs realm XP series that were recorded with the
+// realm's RP. Affected entries are rebuilt from the class XP series written
+// at the same time or dropped if that isn't possible.
+func BackfillRealmXP(stats *Statistics) {
+	for realmName, classes := range realmClasses(stats) {
+		rpSeries := timeseries.RealmRPTimeSeries(realmName)
+		xpSeries := timeseries.RealmXPTimeSeries(realmName)
+		if rpSeries == nil || xpSeries == nil {
+			continue
+		}
+
+		rp := make(map[int64]uint64, len(rpSeries.Entries))
+		for _, e := range rpSeries.Entries {
+			rp[e.Timestamp.Unix()] = e.Value
+		}
+
+		classXP := make(map[int64]uint64)
+		classCount := make(map[int64]int)
+		for _, class := range classes {
+			ts := timeseries.ClassXPTimeSeries(class)
+			if ts == nil {
+				continue
+			}
+			for _, e := range ts.Entries {
+				classXP[e.Timestamp.Unix()] += e.Value
+				classCount[e.Timestamp.Unix()] += 1
+			}
+		}
+
+		changed := false
+		entries := make(timeseries.TimeSeriesEntryArray, 0, len(xpSeries.Entries))
+		for _, e := range xpSeries.Entries {
+			timestamp := e.Timestamp.Unix()
+			if v, ok := rp[timestamp]; !ok || v != e.Value {
+				entries = append(entries, e)
+				continue
+			}
+			changed = true
+			if classCount[timestamp] == len(classes) {
+				e.Value = classXP[timestamp]
+				entries = append(entries, e)
+			}
+		}
+		if !changed {
+			continue
+		}
+
+		log.Printf("Repairing realm XP series of %v", realmName)
+		xpSeries.Entries = entries
+		path := timeseries.TimeSeriesPath("realm", realmName, "xp")
+		if err := xpSeries.Save(path); err != nil {
+			log.Printf("failed to save TS for %v: %v", realmName, err)
+		}
+	}
+}
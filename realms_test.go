@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andir/UthgardCommunityHeraldBackend/timeseries"
+)
+
+func TestRealmsOverviewRPPerDay(t *testing.T) {
+	t.Chdir(t.TempDir())
+	day := 24 * time.Hour
+	now := time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	stats := LoadCharacters(map[string]*Character{
+		"Alice": {Name: "Alice", Realm: "Albion", Rp: 1007000},
+		"Bob":   {Name: "Bob", Realm: "Hibernia", Rp: 2000500},
+	})
+	stats.LastUpdated = now
+
+	writeSeries(t, timeseries.TimeSeriesPath("realm", "Albion", "rp"), map[time.Time]uint64{
+		now.Add(-10 * day): 1000000,
+		now.Add(-1 * day):  1007000,
+	})
+	// the only sample of the week must not count as a gain
+	writeSeries(t, timeseries.TimeSeriesPath("realm", "Hibernia", "rp"), map[time.Time]uint64{
+		now.Add(-2 * day): 2000500,
+	})
+
+	UpdateRealmsOverview(stats)
+
+	want := map[string]float64{"Albion": 1000, "Hibernia": 0}
+	for _, realm := range stats.RealmsOverview.Realms {
+		if realm.RPPerDay != want[realm.Realm] {
+			t.Errorf("%v: RPPerDay = %v, want %v", realm.Realm, realm.RPPerDay, want[realm.Realm])
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/andir/UthgardCommunityHeraldBackend/search"
+)
+
+// foldName reduces a name as it might appear in a URL to the key it is
+// looked up by: URL escapes are decoded and the name is folded with
+// search.Fold.
+func foldName(name string) string {
+	if strings.ContainsAny(name, "%+") {
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+	}
+	return search.Fold(name)
+}
+
+// Resolver maps user supplied names of characters, guilds, realms, classes
+// and races to the names used by the snapshot.
+type Resolver struct {
+	characters map[string]string
+	guilds     map[string]string
+	realms     map[string]string
+	classes    map[string]string
+	races      map[string]string
+}
+
+func NewResolver(characters map[string]*Character) *Resolver {
+	r := &Resolver{
+		characters: make(map[string]string),
+		guilds:     make(map[string]string),
+		realms:     make(map[string]string),
+		classes:    make(map[string]string),
+		races:      make(map[string]string),
+	}
+	add := func(index map[string]string, name string) {
+		if name == "" {
+			return
+		}
+		key := foldName(name)
+		if _, ok := index[key]; !ok {
+			index[key] = name
+		}
+	}
+	for key, char := range characters {
+		add(r.characters, key)
+		add(r.guilds, char.Guild)
+		add(r.realms, char.Realm)
+		add(r.classes, char.Class)
+		add(r.races, char.Race)
+	}
+	return r
+}
+
+func resolve(index map[string]string, name string) (string, bool) {
+	resolved, ok := index[foldName(name)]
+	return resolved, ok
+}
+
+// Character returns the key of the character in Statistics.Characters.
+func (r *Resolver) Character(name string) (string, bool) { return resolve(r.characters, name) }
+func (r *Resolver) Guild(name string) (string, bool)     { return resolve(r.guilds, name) }
+func (r *Resolver) Realm(name string) (string, bool)     { return resolve(r.realms, name) }
+func (r *Resolver) Class(name string) (string, bool)     { return resolve(r.classes, name) }
+func (r *Resolver) Race(name string) (string, bool)      { return resolve(r.races, name) }
+
+// ByVar resolves the value of a route variable by its name, e.g.
+// "guildName".
+func (r *Resolver) ByVar(key, name string) (string, bool) {
+	switch key {
+	case "characterName":
+		return r.Character(name)
+	case "guildName":
+		return r.Guild(name)
+	case "realmName":
+		return r.Realm(name)
+	case "className":
+		return r.Class(name)
+	case "raceName":
+		return r.Race(name)
+	}
+	return name, false
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const MAX_RESPONSE_CACHE_BYTES = 64 << 20
+
+// HOT_ENDPOINTS are encoded right after a snapshot is published, so the
+// first visitors don't have to wait for them.
+var HOT_ENDPOINTS = []string{
+	"/toprp",
+	"/topxp",
+	"/toprp/guilds",
+	"/topxp/guilds",
+}
+
+type cachedResponse struct {
+	contentType string
+	body        []byte
+	gzipped     []byte
+}
+
+type CacheStats struct {
+	Hits    uint64
+	Misses  uint64
+	Entries int
+	Bytes   int
+}
+
+// ResponseCache keeps encoded and gzipped responses of the current snapshot
+// by path and query. All entries are dropped when the generation changes.
+type ResponseCache struct {
+	lock       sync.RWMutex
+	generation int64
+	entries    map[string]*cachedResponse
+	size       int
+
+	hits   uint64
+	misses uint64
+
+	hot map[string]http.Handler
+}
+
+func NewResponseCache() *ResponseCache {
+	return &ResponseCache{
+		entries: make(map[string]*cachedResponse),
+		hot:     make(map[string]http.Handler),
+	}
+}
+
+func cacheKey(req *http.Request) string {
+	return req.URL.Path + "?" + req.URL.RawQuery
+}
+
+func (c *ResponseCache) get(generation int64, key string) (*cachedResponse, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if c.generation != generation {
+		return nil, false
+	}
+	entry, ok := c.entries[key]
+	return entry, ok
+}
+
+func (c *ResponseCache) put(generation int64, key string, entry *cachedResponse) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.generation != generation {
+		if generation < c.generation {
+			return
+		}
+		c.reset(generation)
+	}
+	size := len(entry.body) + len(entry.gzipped)
+	if c.size+size > MAX_RESPONSE_CACHE_BYTES {
+		return
+	}
+	if old, ok := c.entries[key]; ok {
+		c.size -= len(old.body) + len(old.gzipped)
+	}
+	c.entries[key] = entry
+	c.size += size
+}
+
+func (c *ResponseCache) reset(generation int64) {
+	c.generation = generation
+	c.entries = make(map[string]*cachedResponse)
+	c.size = 0
+}
+
+// Invalidate drops all responses of older snapshots.
+func (c *ResponseCache) Invalidate(generation int64) {
+	stats := c.Stats()
+	log.Printf("response cache: %d hits, %d misses, %d entries (%d bytes) dropped\n", stats.Hits, stats.Misses, stats.Entries, stats.Bytes)
+	c.lock.Lock()
+	c.reset(generation)
+	c.lock.Unlock()
+}
+
+func (c *ResponseCache) Stats() CacheStats {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return CacheStats{
+		Hits:    atomic.LoadUint64(&c.hits),
+		Misses:  atomic.LoadUint64(&c.misses),
+		Entries: len(c.entries),
+		Bytes:   c.size,
+	}
+}
+
+// acceptsEncoding checks whether the Accept-Encoding header of the request
+// allows the given content coding.
+func acceptsEncoding(req *http.Request, coding string) bool {
+	for _, part := range strings.Split(req.Header.Get("Accept-Encoding"), ",") {
+		fields := strings.Split(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(fields[0]), coding) {
+			continue
+		}
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// responseRecorder buffers a response so that it can be cached.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{
+		header: make(http.Header),
+		status: http.StatusOK,
+	}
+}
+
+func (r *responseRecorder) Header() http.Header         { return r.header }
+func (r *responseRecorder) Write(b []byte) (int, error) { return r.body.Write(b) }
+func (r *responseRecorder) WriteHeader(status int)      { r.status = status }
+
+func (r *responseRecorder) writeTo(wr http.ResponseWriter) {
+	for key, values := range r.header {
+		wr.Header()[key] = values
+	}
+	wr.WriteHeader(r.status)
+	wr.Write(r.body.Bytes())
+}
+
+func (c *ResponseCache) write(stats *Statistics, wr http.ResponseWriter, req *http.Request, entry *cachedResponse, status string) {
+	wr.Header().Set("Content-Type", entry.contentType)
+	wr.Header().Set("X-Cache", status)
+	wr.Header().Add("Vary", "Accept-Encoding")
+	setCacheHeaders(stats, wr, req)
+	if acceptsEncoding(req, "gzip") {
+		wr.Header().Set("Content-Encoding", "gzip")
+		wr.WriteHeader(http.StatusOK)
+		wr.Write(entry.gzipped)
+		return
+	}
+	wr.WriteHeader(http.StatusOK)
+	wr.Write(entry.body)
+}
+
+// Handler serves successful GET responses of the wrapped handler from the
+// cache.
+func (c *ResponseCache) Handler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		stats := statistics
+		if stats == nil || (req.Method != http.MethodGet && req.Method != http.MethodHead) {
+			handler.ServeHTTP(wr, req)
+			return
+		}
+		if writeNotModified(stats, wr, req) {
+			return
+		}
+
+		key := cacheKey(req)
+		if entry, ok := c.get(stats.Generation, key); ok {
+			atomic.AddUint64(&c.hits, 1)
+			c.write(stats, wr, req, entry, "HIT")
+			return
+		}
+		atomic.AddUint64(&c.misses, 1)
+
+		rec := newResponseRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.status != http.StatusOK || req.Method != http.MethodGet {
+			rec.writeTo(wr)
+			return
+		}
+
+		var gzipped bytes.Buffer
+		gz := gzip.NewWriter(&gzipped)
+		gz.Write(rec.body.Bytes())
+		gz.Close()
+		entry := &cachedResponse{
+			contentType: rec.header.Get("Content-Type"),
+			body:        rec.body.Bytes(),
+			gzipped:     gzipped.Bytes(),
+		}
+		c.put(stats.Generation, key, entry)
+		c.write(stats, wr, req, entry, "MISS")
+	})
+}
+
+// Hot registers a cached handler to be encoded ahead of time by Warm.
+func (c *ResponseCache) Hot(path string, handler http.Handler) {
+	c.hot[path] = handler
+}
+
+// Warm encodes the hot endpoints for the current snapshot.
+func (c *ResponseCache) Warm() {
+	for path, handler := range c.hot {
+		req, err := http.NewRequest(http.MethodGet, path, nil)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		handler.ServeHTTP(newResponseRecorder(), req)
+	}
+}
+
+var responseCache = NewResponseCache()
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResponseCache(t *testing.T) {
+	old := statistics
+	defer func() { statistics = old }()
+	statistics = &Statistics{Generation: 1}
+
+	body := strings.Repeat(`{"Name":"Alice"}`, 100)
+	calls := 0
+	cache := NewResponseCache()
+	handler := cache.Handler(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		calls += 1
+		wr.Header().Set("Content-Type", "application/json")
+		wr.Write([]byte(body))
+	}))
+	get := func(acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/toprp?realm=Albion", nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	check := func(rec *httptest.ResponseRecorder, cacheStatus string, gzipped bool) {
+		t.Helper()
+		if got := rec.Header().Get("X-Cache"); got != cacheStatus {
+			t.Errorf("X-Cache %v, want %v", got, cacheStatus)
+		}
+		if !strings.Contains(rec.Header().Get("Vary"), "Accept-Encoding") {
+			t.Errorf("Vary %q", rec.Header().Get("Vary"))
+		}
+		got := rec.Body.Bytes()
+		if gzipped {
+			if rec.Header().Get("Content-Encoding") != "gzip" {
+				t.Fatalf("Content-Encoding %q, want gzip", rec.Header().Get("Content-Encoding"))
+			}
+			gz, err := gzip.NewReader(bytes.NewReader(got))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err = ioutil.ReadAll(gz); err != nil {
+				t.Fatal(err)
+			}
+		} else if rec.Header().Get("Content-Encoding") != "" {
+			t.Fatalf("Content-Encoding %q, want none", rec.Header().Get("Content-Encoding"))
+		}
+		if string(got) != body {
+			t.Errorf("body %q", got)
+		}
+	}
+
+	check(get("gzip"), "MISS", true)
+	// the cached gzip variant is never sent to clients that didn't ask for it
+	check(get(""), "HIT", false)
+	check(get("gzip;q=0, identity"), "HIT", false)
+	check(get("br"), "HIT", false)
+	check(get("deflate, gzip;q=0.5"), "HIT", true)
+	if calls != 1 {
+		t.Errorf("handler called %v times, want 1", calls)
+	}
+
+	cache.Invalidate(statistics.Generation)
+	check(get(""), "MISS", false)
+	check(get("gzip"), "HIT", true)
+	if calls != 2 {
+		t.Errorf("handler called %v times after Invalidate, want 2", calls)
+	}
+
+	statistics = &Statistics{Generation: 2}
+	check(get(""), "MISS", false)
+	if stats := cache.Stats(); stats.Hits != 5 || stats.Misses != 3 || stats.Entries != 1 {
+		t.Errorf("stats %+v", stats)
+	}
+}
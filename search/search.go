@@ -0,0 +1,275 @@
+package search
+
+import (
+	"sort"
+	"strings"
+)
+
+const (
+	MatchExact     = "exact"
+	MatchPrefix    = "prefix"
+	MatchSubstring = "substring"
+	MatchFuzzy     = "fuzzy"
+)
+
+// base scores of the match kinds, better matches always rank first
+const (
+	scoreExact     = 1000
+	scorePrefix    = 800
+	scoreSubstring = 600
+	scoreFuzzy     = 400
+)
+
+var accents = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'æ': "ae",
+	'ç': "c", 'è': "e", 'é': "e", 'ê': "e", 'ë': "e",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ð': "d", 'ñ': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ý': "y", 'ÿ': "y",
+	'þ': "th", 'ß': "ss", 'œ': "oe",
+}
+
+var apostrophes = strings.NewReplacer("’", "'", "‘", "'", "`", "'", "´", "'")
+
+// Fold returns the canonical form of a name that names are looked up by:
+// case, surrounding and repeated whitespace and the variants of apostrophes
+// are ignored.
+func Fold(s string) string {
+	s = apostrophes.Replace(s)
+	s = strings.Join(strings.Fields(s), " ")
+	return strings.ToLower(s)
+}
+
+// Normalize folds s and strips accents so that "Ælfrëd " and "aelfred" are
+// the same search key.
+func Normalize(s string) string {
+	b := strings.Builder{}
+	for _, r := range Fold(s) {
+		if replacement, ok := accents[r]; ok {
+			b.WriteString(replacement)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+type entry struct {
+	Key   string
+	Runes []rune // of Key
+	Name  string
+	Value interface{}
+}
+
+type Result struct {
+	Name  string
+	Value interface{}
+	Match string
+	Score int
+}
+
+// Index supports prefix, substring and typo tolerant lookups of names. It
+// is built once and is read only afterwards.
+type Index struct {
+	entries  []entry // sorted by Key
+	trigrams map[string][]int
+}
+
+func NewIndex() *Index {
+	return &Index{
+		entries:  make([]entry, 0),
+		trigrams: make(map[string][]int),
+	}
+}
+
+// Add adds a name to the index, Build has to be called afterwards.
+func (i *Index) Add(name string, value interface{}) {
+	key := Normalize(name)
+	i.entries = append(i.entries, entry{
+		Key:   key,
+		Runes: []rune(key),
+		Name:  name,
+		Value: value,
+	})
+}
+
+func trigrams(s string) []string {
+	r := []rune(s)
+	results := make([]string, 0, len(r))
+	for n := 0; n+3 <= len(r); n++ {
+		results = append(results, string(r[n:n+3]))
+	}
+	return results
+}
+
+// Build sorts the entries and creates the trigram index.
+func (i *Index) Build() {
+	sort.Slice(i.entries, func(a, b int) bool { return i.entries[a].Key < i.entries[b].Key })
+	i.trigrams = make(map[string][]int)
+	for n, e := range i.entries {
+		seen := make(map[string]bool)
+		for _, t := range trigrams(e.Key) {
+			if !seen[t] {
+				seen[t] = true
+				i.trigrams[t] = append(i.trigrams[t], n)
+			}
+		}
+	}
+}
+
+func (i *Index) Len() int {
+	return len(i.entries)
+}
+
+// Prefix calls fn for every entry whose key starts with the normalized
+// prefix in key order until fn returns true.
+func (i *Index) Prefix(prefix string, fn func(name string, value interface{}) bool) {
+	prefix = Normalize(prefix)
+	n := sort.Search(len(i.entries), func(n int) bool { return i.entries[n].Key >= prefix })
+	for ; n < len(i.entries) && strings.HasPrefix(i.entries[n].Key, prefix); n++ {
+		if fn(i.entries[n].Name, i.entries[n].Value) {
+			return
+		}
+	}
+}
+
+// substring returns the ids of all entries containing query.
+func (i *Index) substring(query string) []int {
+	grams := trigrams(query)
+	if len(grams) == 0 {
+		results := make([]int, 0)
+		for n, e := range i.entries {
+			if strings.Contains(e.Key, query) {
+				results = append(results, n)
+			}
+		}
+		return results
+	}
+
+	// start with the rarest trigram and verify the candidates
+	candidates := i.trigrams[grams[0]]
+	for _, g := range grams[1:] {
+		if len(i.trigrams[g]) < len(candidates) {
+			candidates = i.trigrams[g]
+		}
+	}
+	results := make([]int, 0)
+	for _, n := range candidates {
+		if strings.Contains(i.entries[n].Key, query) {
+			results = append(results, n)
+		}
+	}
+	return results
+}
+
+// MaxDistance is the number of typos tolerated for a query of the given
+// length.
+func MaxDistance(length int) int {
+	if length < 3 {
+		return 0
+	} else if length < 6 {
+		return 1
+	}
+	return 2
+}
+
+// Distance calculates the Levenshtein distance of a and b, giving up once
+// it exceeds max.
+func Distance(a, b []rune, max int) int {
+	if d := len(a) - len(b); d > max || -d > max {
+		return max + 1
+	}
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for n := range prev {
+		prev[n] = n
+	}
+	for x := 1; x <= len(a); x++ {
+		cur[0] = x
+		best := cur[0]
+		for y := 1; y <= len(b); y++ {
+			cost := 1
+			if a[x-1] == b[y-1] {
+				cost = 0
+			}
+			cur[y] = minInt(minInt(prev[y]+1, cur[y-1]+1), prev[y-1]+cost)
+			best = minInt(best, cur[y])
+		}
+		if best > max {
+			return max + 1
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Search finds entries by exact, prefix, substring and typo tolerant
+// matching and returns the limit best of them. Better kinds of matches
+// rank first, within a kind shorter names and earlier matches rank first.
+func (i *Index) Search(query string, limit int) []Result {
+	query = Normalize(query)
+	if query == "" || limit <= 0 {
+		return []Result{}
+	}
+
+	scores := make(map[int]Result)
+	add := func(n int, match string, score int) {
+		if r, ok := scores[n]; ok && r.Score >= score {
+			return
+		}
+		scores[n] = Result{
+			Name:  i.entries[n].Name,
+			Value: i.entries[n].Value,
+			Match: match,
+			Score: score,
+		}
+	}
+
+	queryLen := len([]rune(query))
+	for _, n := range i.substring(query) {
+		key := i.entries[n].Key
+		extra := len(i.entries[n].Runes) - queryLen
+		pos := strings.Index(key, query)
+		if extra == 0 {
+			add(n, MatchExact, scoreExact)
+		} else if pos == 0 {
+			add(n, MatchPrefix, scorePrefix-minInt(extra, 100))
+		} else {
+			add(n, MatchSubstring, scoreSubstring-minInt(pos+extra, 100))
+		}
+	}
+
+	if max := MaxDistance(queryLen); max > 0 {
+		q := []rune(query)
+		for n, e := range i.entries {
+			if _, ok := scores[n]; ok {
+				continue
+			}
+			if d := Distance(q, e.Runes, max); d <= max {
+				add(n, MatchFuzzy, scoreFuzzy-50*d)
+			}
+		}
+	}
+
+	results := make([]Result, 0, len(scores))
+	for _, r := range scores {
+		results = append(results, r)
+	}
+	sort.Slice(results, func(a, b int) bool {
+		if results[a].Score != results[b].Score {
+			return results[a].Score > results[b].Score
+		}
+		return results[a].Name < results[b].Name
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
@@ -0,0 +1,148 @@
+package search
+
+import (
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	for in, want := range map[string]string{
+		"Aelfred":    "aelfred",
+		" Ælfrëd  ":  "aelfred",
+		"ÉOWYN":      "eowyn",
+		"Straße":     "strasse",
+		"Þórr":       "thorr",
+		"Knights Of": "knights of",
+		"":           "",
+	} {
+		if got := Normalize(in); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func newIndex(names ...string) *Index {
+	index := NewIndex()
+	for _, name := range names {
+		index.Add(name, name)
+	}
+	index.Build()
+	return index
+}
+
+func resultNames(results []Result) []string {
+	names := make([]string, len(results))
+	for i, r := range results {
+		names[i] = r.Name
+	}
+	return names
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSearchSubstring(t *testing.T) {
+	index := newIndex("Darkblade", "Bladestorm", "Shadowblade", "Blad", "Moonshadow", "Ælfblade")
+
+	for _, c := range []struct {
+		query string
+		want  []string
+	}{
+		// exact before prefix before substring, shorter and earlier
+		// matches first
+		{"blad", []string{"Blad", "Bladestorm", "Darkblade", "Ælfblade", "Shadowblade"}},
+		{"shadow", []string{"Shadowblade", "Moonshadow"}},
+		// accent insensitive
+		{"AELF", []string{"Ælfblade"}},
+		// queries shorter than a trigram
+		{"oo", []string{"Moonshadow"}},
+	} {
+		got := resultNames(index.Search(c.query, 10))
+		if !equal(got, c.want) {
+			t.Errorf("Search(%q) = %v, want %v", c.query, got, c.want)
+		}
+	}
+
+	for _, r := range index.Search("blade", 10) {
+		want := MatchSubstring
+		if r.Name == "Bladestorm" {
+			want = MatchPrefix
+		} else if r.Name == "Blad" {
+			want = MatchFuzzy
+		}
+		if r.Match != want {
+			t.Errorf("%v matched %v, want %v", r.Name, r.Match, want)
+		}
+	}
+	if got := index.Search("blad", 2); len(got) != 2 {
+		t.Errorf("limit ignored, got %v results", len(got))
+	}
+}
+
+func TestDistance(t *testing.T) {
+	for _, c := range []struct {
+		a, b string
+		max  int
+		want int
+	}{
+		{"kitten", "kitten", 2, 0},
+		{"kitten", "sitten", 2, 1},
+		{"kitten", "sitting", 3, 3},
+		{"flaw", "lawn", 2, 2},
+		// gives up beyond max
+		{"kitten", "sitting", 2, 3},
+		{"a", "abcdef", 2, 3},
+	} {
+		if got := Distance([]rune(c.a), []rune(c.b), c.max); got != c.want {
+			t.Errorf("Distance(%q, %q, %v) = %v, want %v", c.a, c.b, c.max, got, c.want)
+		}
+	}
+}
+
+func TestSearchFuzzyRanking(t *testing.T) {
+	index := newIndex("Gandalf", "Gandolf", "Gendolf", "Randall", "Gimli")
+
+	results := index.Search("gandalf", 10)
+	got := resultNames(results)
+	// the exact match first, then by the number of typos and name
+	want := []string{"Gandalf", "Gandolf", "Gendolf", "Randall"}
+	if !equal(got, want) {
+		t.Fatalf("Search = %v, want %v", got, want)
+	}
+	if results[0].Match != MatchExact || results[1].Match != MatchFuzzy {
+		t.Errorf("matches %v and %v", results[0].Match, results[1].Match)
+	}
+	if !(results[0].Score > results[1].Score && results[1].Score > results[2].Score) {
+		t.Errorf("scores not descending: %+v", results)
+	}
+
+	// short queries tolerate fewer typos
+	if got := index.Search("gx", 10); len(got) != 0 {
+		t.Errorf("fuzzy match for a two letter query: %v", resultNames(got))
+	}
+}
+
+func TestFold(t *testing.T) {
+	for in, want := range map[string]string{
+		"Knights  of\tAlbion ": "knights of albion",
+		"O’Brien":              "o'brien",
+		"O`Brien":              "o'brien",
+		"Ælfrëd":               "ælfrëd",
+	} {
+		if got := Fold(in); got != want {
+			t.Errorf("Fold(%q) = %q, want %q", in, got, want)
+		}
+		// search keys are built on the folded name
+		if Normalize(in) != Normalize(Fold(in)) {
+			t.Errorf("Normalize(%q) differs from the normalized folded name", in)
+		}
+	}
+}
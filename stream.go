@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	STREAM_TOP_MOVERS     = 10
+	STREAM_NEW_CHARACTERS = 20
+	STREAM_HEARTBEAT      = 30 * time.Second
+)
+
+type Mover struct {
+	Name  string
+	Guild string
+	Realm string
+	Class string
+	RP    int64
+}
+
+// SnapshotEvent announces that a new snapshot has been published.
+type SnapshotEvent struct {
+	Generation    int64
+	Fetched       time.Time
+	LastUpdated   time.Time
+	Characters    int
+	NewCharacters int
+	// the first STREAM_NEW_CHARACTERS of NewCharacters
+	NewCharacterNames []string
+	// characters that gained the most RP since the previous snapshot
+	TopMovers []Mover
+}
+
+func NewSnapshotEvent(prev, cur *Statistics) *SnapshotEvent {
+	e := &SnapshotEvent{
+		Generation:        cur.Generation,
+		Fetched:           cur.Fetched,
+		LastUpdated:       cur.LastUpdated,
+		Characters:        len(cur.Characters),
+		NewCharacterNames: make([]string, 0),
+		TopMovers:         make([]Mover, 0),
+	}
+	if prev == nil {
+		return e
+	}
+
+	movers := make([]Mover, 0)
+	for name, char := range cur.Characters {
+		old, ok := prev.Characters[name]
+		if !ok {
+			e.NewCharacters += 1
+			if len(e.NewCharacterNames) < STREAM_NEW_CHARACTERS {
+				e.NewCharacterNames = append(e.NewCharacterNames, char.Name)
+			}
+			continue
+		}
+		if char.Rp > old.Rp {
+			movers = append(movers, Mover{
+				Name:  char.Name,
+				Guild: char.Guild,
+				Realm: char.Realm,
+				Class: char.Class,
+				RP:    int64(char.Rp - old.Rp),
+			})
+		}
+	}
+	sort.Slice(movers, func(a, b int) bool { return movers[a].RP > movers[b].RP })
+	e.TopMovers = movers[:min(len(movers), STREAM_TOP_MOVERS)]
+	sort.Strings(e.NewCharacterNames)
+	return e
+}
+
+// Broker fans out server-sent events to all connected clients. Clients
+// that can't keep up miss events instead of blocking the publisher.
+type Broker struct {
+	lock    sync.RWMutex
+	clients map[chan []byte]bool
+	last    []byte
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		clients: make(map[chan []byte]bool),
+	}
+}
+
+func (b *Broker) Subscribe() (ch chan []byte, last []byte) {
+	ch = make(chan []byte, 4)
+	b.lock.Lock()
+	b.clients[ch] = true
+	last = b.last
+	b.lock.Unlock()
+	return
+}
+
+func (b *Broker) Unsubscribe(ch chan []byte) {
+	b.lock.Lock()
+	delete(b.clients, ch)
+	b.lock.Unlock()
+}
+
+func (b *Broker) Publish(e *SnapshotEvent) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	msg := []byte(fmt.Sprintf("id: %v\nevent: snapshot\ndata: %s\n\n", e.Generation, data))
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.last = msg
+	for ch := range b.clients {
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
+
+// ServeHTTP streams snapshot events to the client, starting with the
+// current one.
+func (b *Broker) ServeHTTP(wr http.ResponseWriter, req *http.Request) {
+	flusher, ok := wr.(http.Flusher)
+	if !ok {
+		http.Error(wr, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	ch, last := b.Subscribe()
+	defer b.Unsubscribe(ch)
+
+	wr.Header().Set("Content-Type", "text/event-stream")
+	wr.Header().Set("Cache-Control", "no-cache")
+	wr.Header().Set("Connection", "keep-alive")
+	wr.WriteHeader(http.StatusOK)
+	if last != nil {
+		wr.Write(last)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(STREAM_HEARTBEAT)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case msg := <-ch:
+			wr.Write(msg)
+		case <-heartbeat.C:
+			wr.Write([]byte(": ping\n\n"))
+		case <-req.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
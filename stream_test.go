@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readEvent reads the lines of the next event that isn't a heartbeat.
+func readEvent(t *testing.T, r *bufio.Reader) []string {
+	t.Helper()
+	lines := make([]string, 0)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			if len(lines) > 0 {
+				return lines
+			}
+			continue
+		}
+		if !strings.HasPrefix(line, ":") {
+			lines = append(lines, line)
+		}
+	}
+}
+
+func clients(b *Broker) int {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return len(b.clients)
+}
+
+func TestBrokerStream(t *testing.T) {
+	b := NewBroker()
+	b.Publish(&SnapshotEvent{Generation: 1})
+	server := httptest.NewServer(b)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type %v", ct)
+	}
+	r := bufio.NewReader(resp.Body)
+
+	// the current snapshot is sent right away
+	lines := readEvent(t, r)
+	if len(lines) != 3 || lines[0] != "id: 1" || lines[1] != "event: snapshot" || !strings.HasPrefix(lines[2], `data: {"Generation":1,`) {
+		t.Fatalf("first event %q", lines)
+	}
+
+	b.Publish(&SnapshotEvent{Generation: 2})
+	if lines := readEvent(t, r); lines[0] != "id: 2" {
+		t.Fatalf("second event %q", lines)
+	}
+	if n := clients(b); n != 1 {
+		t.Errorf("%v subscribers, want 1", n)
+	}
+
+	resp.Body.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for clients(b) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("client was not unsubscribed after disconnecting")
+		}
+		// the handler notices the disconnect once it writes
+		b.Publish(&SnapshotEvent{Generation: 3})
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBrokerDropsForSlowSubscribers(t *testing.T) {
+	b := NewBroker()
+	slow, _ := b.Subscribe()
+	defer b.Unsubscribe(slow)
+
+	published := make(chan bool)
+	go func() {
+		for i := int64(1); i <= 10; i++ {
+			b.Publish(&SnapshotEvent{Generation: i})
+		}
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a subscriber that doesn't read blocked the publisher")
+	}
+
+	// the buffered events are kept, the rest is dropped
+	received := 0
+	for len(slow) > 0 {
+		msg := <-slow
+		received += 1
+		if want := fmt.Sprintf("id: %v\n", received); !strings.HasPrefix(string(msg), want) {
+			t.Errorf("event %v is %q", received, msg)
+		}
+	}
+	if received != cap(slow) {
+		t.Errorf("received %v events, want %v", received, cap(slow))
+	}
+
+	_, last := b.Subscribe()
+	if !strings.HasPrefix(string(last), "id: 10\n") {
+		t.Errorf("new subscribers start with %q", last)
+	}
+}
+
+func TestNewSnapshotEvent(t *testing.T) {
+	prev := LoadCharacters(map[string]*Character{
+		"Alice": {Name: "Alice", Rp: 100},
+		"Bob":   {Name: "Bob", Rp: 100},
+	})
+	cur := LoadCharacters(map[string]*Character{
+		"Alice": {Name: "Alice", Rp: 150},
+		"Bob":   {Name: "Bob", Rp: 400},
+		"Carol": {Name: "Carol", Rp: 10},
+	})
+	e := NewSnapshotEvent(prev, cur)
+	if e.Characters != 3 || e.NewCharacters != 1 || len(e.NewCharacterNames) != 1 || e.NewCharacterNames[0] != "Carol" {
+		t.Errorf("new characters: %+v", e)
+	}
+	if len(e.TopMovers) != 2 || e.TopMovers[0].Name != "Bob" || e.TopMovers[0].RP != 300 || e.TopMovers[1].RP != 50 {
+		t.Errorf("movers: %+v", e.TopMovers)
+	}
+}
@@ -0,0 +1,366 @@
+package timeseries
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	ARCHIVE_VERSION  = 1
+	ARCHIVE_MANIFEST = "manifest.json"
+	ROSTER_FILE      = "roster.json"
+)
+
+// ArchiveFile describes a series in an archive. Series are archived as
+// uncompressed JSON, Path is relative to the data directory and lacks the
+// .gz suffix of the stored file.
+type ArchiveFile struct {
+	Path    string
+	SHA256  string
+	Size    int64
+	Entries int
+}
+
+// Manifest is the last file of an archive and lists all others.
+type Manifest struct {
+	Version int
+	Created time.Time
+	Files   []ArchiveFile
+}
+
+type ImportStats struct {
+	Files   int
+	Created int
+	Entries int // entries that were added
+	Skipped int // entries that already existed
+}
+
+// isSeriesPath matches the files written by TimeSeriesPath,
+// <type>/<prefix>/<name>/<metric>.json.gz relative to the data directory.
+func isSeriesPath(rel string) bool {
+	return strings.HasSuffix(rel, ".json.gz") && len(strings.Split(filepath.ToSlash(rel), "/")) == 4
+}
+
+func isRoster(rel string) bool {
+	return strings.TrimSuffix(filepath.Base(rel), ".gz") == ROSTER_FILE
+}
+
+func readGzip(filename string) ([]byte, error) {
+	fh, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	gReader, err := gzip.NewReader(fh)
+	if err != nil {
+		return nil, err
+	}
+	defer gReader.Close()
+	return ioutil.ReadAll(gReader)
+}
+
+func countEntries(rel string, data []byte) (int, error) {
+	if isRoster(rel) {
+		r := &Roster{}
+		if err := json.Unmarshal(data, r); err != nil {
+			return 0, err
+		}
+		return len(r.Members), nil
+	}
+	ts := &TimeSeries{}
+	if err := json.Unmarshal(data, ts); err != nil {
+		return 0, err
+	}
+	return len(ts.Entries), nil
+}
+
+// Export writes all series below root into a gzipped tar archive followed
+// by a manifest. Unreadable series are logged and left out.
+func Export(root string, w io.Writer) (*Manifest, error) {
+	gWriter := gzip.NewWriter(w)
+	tWriter := tar.NewWriter(gWriter)
+	manifest := &Manifest{
+		Version: ARCHIVE_VERSION,
+		Created: time.Now().UTC(),
+		Files:   make([]ArchiveFile, 0),
+	}
+
+	write := func(name string, data []byte) error {
+		err := tWriter.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0644,
+			Size:    int64(len(data)),
+			ModTime: manifest.Created,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = tWriter.Write(data)
+		return err
+	}
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || info.IsDir() || !isSeriesPath(rel) {
+			return err
+		}
+		rel = strings.TrimSuffix(filepath.ToSlash(rel), ".gz")
+
+		data, err := readGzip(path)
+		if err != nil {
+			log.Printf("%v: %v", path, err)
+			return nil
+		}
+		entries, err := countEntries(rel, data)
+		if err != nil {
+			log.Printf("%v: %v", path, err)
+			return nil
+		}
+		sum := sha256.Sum256(data)
+		manifest.Files = append(manifest.Files, ArchiveFile{
+			Path:    rel,
+			SHA256:  hex.EncodeToString(sum[:]),
+			Size:    int64(len(data)),
+			Entries: entries,
+		})
+		return write(rel, data)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := write(ARCHIVE_MANIFEST, data); err != nil {
+		return nil, err
+	}
+	if err := tWriter.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, gWriter.Close()
+}
+
+// readArchive calls fn with every series of an archive and returns the
+// manifest, which is only known once the whole archive has been read.
+func readArchive(r io.Reader, fn func(name string, data []byte) error) (*Manifest, error) {
+	gReader, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gReader.Close()
+
+	var manifest *Manifest
+	tReader := tar.NewReader(gReader)
+	for {
+		header, err := tReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(tReader)
+		if err != nil {
+			return nil, err
+		}
+		if header.Name == ARCHIVE_MANIFEST {
+			manifest = &Manifest{}
+			if err := json.Unmarshal(data, manifest); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := fn(header.Name, data); err != nil {
+			return nil, err
+		}
+	}
+	if manifest == nil {
+		return nil, fmt.Errorf("archive has no manifest")
+	}
+	return manifest, nil
+}
+
+// Verify checks the archive against its manifest: every listed series has
+// to be present with a matching checksum and nothing else may be included.
+func Verify(r io.Reader) (*Manifest, error) {
+	sums := make(map[string]string)
+	manifest, err := readArchive(r, func(name string, data []byte) error {
+		if !isSeriesPath(name+".gz") || strings.Contains(name, "..") {
+			return fmt.Errorf("unexpected file %v in archive", name)
+		}
+		sum := sha256.Sum256(data)
+		sums[name] = hex.EncodeToString(sum[:])
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if manifest.Version != ARCHIVE_VERSION {
+		return nil, fmt.Errorf("unsupported archive version %v", manifest.Version)
+	}
+	if len(sums) != len(manifest.Files) {
+		return nil, fmt.Errorf("archive contains %v series, manifest lists %v", len(sums), len(manifest.Files))
+	}
+	for _, file := range manifest.Files {
+		sum, ok := sums[file.Path]
+		if !ok {
+			return nil, fmt.Errorf("%v is missing from the archive", file.Path)
+		}
+		if sum != file.SHA256 {
+			return nil, fmt.Errorf("checksum mismatch for %v", file.Path)
+		}
+	}
+	return manifest, nil
+}
+
+// Merge adds the entries whose timestamps are not part of the series yet.
+func (t *TimeSeries) Merge(entries []TimeSeriesEntry) (added int) {
+	known := make(map[int64]bool, len(t.Entries))
+	for _, e := range t.Entries {
+		known[e.Timestamp.UnixNano()] = true
+	}
+	for _, e := range entries {
+		if known[e.Timestamp.UnixNano()] {
+			continue
+		}
+		known[e.Timestamp.UnixNano()] = true
+		t.Entries = append(t.Entries, e)
+		added += 1
+	}
+	if added > 0 {
+		sort.Sort(&t.Entries)
+	}
+	return
+}
+
+// Merge adds the stays of other that are not part of the roster yet. Stays
+// are the same if they were joined and left at the same time. A stay that
+// is open in the roster but was closed in other is replaced, other knows
+// when it ended.
+func (r *Roster) Merge(other *Roster) (added int) {
+	if r.Members == nil {
+		r.Members = make(map[string][]Membership)
+	}
+	if r.Since.IsZero() || (!other.Since.IsZero() && other.Since.Before(r.Since)) {
+		r.Since = other.Since
+	}
+	for name, stays := range other.Members {
+		existing := r.Members[name]
+	next:
+		for _, m := range stays {
+			for i, e := range existing {
+				if !e.Joined.Equal(m.Joined) {
+					continue
+				}
+				if e.Left.Equal(m.Left) {
+					continue next
+				}
+				if e.Active() {
+					existing[i].Left = m.Left
+					added += 1
+					continue next
+				}
+				if m.Active() {
+					continue next
+				}
+			}
+			existing = append(existing, m)
+			added += 1
+		}
+		sort.Slice(existing, func(a, b int) bool {
+			if !existing[a].Joined.Equal(existing[b].Joined) {
+				return existing[a].Joined.Before(existing[b].Joined)
+			}
+			// open stays last
+			return !existing[a].Active() && (existing[b].Active() || existing[a].Left.Before(existing[b].Left))
+		})
+		r.Members[name] = existing
+	}
+	return
+}
+
+func importFile(root, name string, data []byte, stats *ImportStats) error {
+	filename := filepath.Join(root, filepath.FromSlash(name)+".gz")
+	_, err := os.Stat(filename)
+	exists := err == nil
+	stats.Files += 1
+	if !exists {
+		stats.Created += 1
+	}
+
+	if isRoster(name) {
+		other := &Roster{}
+		if err := json.Unmarshal(data, other); err != nil {
+			return err
+		}
+		r := &Roster{}
+		if exists {
+			if r = OpenRoster(filename); r == nil {
+				return fmt.Errorf("%v could not be read", filename)
+			}
+		}
+		added := r.Merge(other)
+		for _, stays := range other.Members {
+			stats.Skipped += len(stays)
+		}
+		stats.Entries += added
+		stats.Skipped -= added
+		if added == 0 && exists {
+			return nil
+		}
+		return r.Save(filename)
+	}
+
+	other := &TimeSeries{}
+	if err := json.Unmarshal(data, other); err != nil {
+		return err
+	}
+	ts := &TimeSeries{Entries: make(TimeSeriesEntryArray, 0)}
+	if exists {
+		if ts = OpenTimeSeries(filename); ts == nil {
+			return fmt.Errorf("%v could not be read", filename)
+		}
+	}
+	added := ts.Merge(other.Entries)
+	stats.Entries += added
+	stats.Skipped += len(other.Entries) - added
+	if added == 0 && exists {
+		return nil
+	}
+	return ts.Save(filename)
+}
+
+// Import verifies an archive and merges its series into the ones below
+// root. The archive is read twice, so nothing is written unless the whole
+// archive matches its manifest.
+func Import(root string, archive io.ReadSeeker) (*ImportStats, error) {
+	if _, err := Verify(archive); err != nil {
+		return nil, err
+	}
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	stats := &ImportStats{}
+	_, err := readArchive(archive, func(name string, data []byte) error {
+		return importFile(root, name, data, stats)
+	})
+	return stats, err
+}
@@ -0,0 +1,175 @@
+package timeseries
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRosterMerge(t *testing.T) {
+	t0 := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	r := &Roster{
+		Since: t0,
+		Members: map[string][]Membership{
+			"Alice": {{Joined: t0, Left: t0.Add(time.Hour)}},
+			"Bob":   {{Joined: t0}},
+		},
+	}
+	other := &Roster{
+		Since: t0,
+		Members: map[string][]Membership{
+			// same joined, left again later
+			"Alice": {{Joined: t0, Left: t0.Add(time.Hour)}, {Joined: t0, Left: t0.Add(3 * time.Hour)}},
+			// closed in the other roster
+			"Bob": {{Joined: t0, Left: t0.Add(2 * time.Hour)}},
+		},
+	}
+	if added := r.Merge(other); added != 2 {
+		t.Errorf("added %v stays, want 2", added)
+	}
+	if added := r.Merge(other); added != 0 {
+		t.Errorf("merging again added %v stays", added)
+	}
+	if got := r.Members["Alice"]; len(got) != 2 || !got[1].Left.Equal(t0.Add(3*time.Hour)) {
+		t.Errorf("Alice: %v", got)
+	}
+	if got := r.Members["Bob"]; len(got) != 1 || !got[0].Left.Equal(t0.Add(2*time.Hour)) {
+		t.Errorf("Bob: %v", got)
+	}
+}
+
+func writeTestData(t *testing.T, root string, t0 time.Time) {
+	t.Helper()
+	ts := &TimeSeries{}
+	ts.Append(10, t0)
+	ts.Append(20, t0.Add(time.Hour))
+	if err := ts.Save(filepath.Join(root, "guild", "kn", "knights", "rp.json.gz")); err != nil {
+		t.Fatal(err)
+	}
+	r := &Roster{}
+	r.Update([]string{"Alice", "Bob"}, t0)
+	r.Update([]string{"Alice"}, t0.Add(time.Hour))
+	if err := r.Save(filepath.Join(root, "guild", "kn", "knights", "roster.json.gz")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	t0 := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	src, dst := t.TempDir(), t.TempDir()
+	writeTestData(t, src, t0)
+
+	archive := &bytes.Buffer{}
+	manifest, err := Export(src, archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Files) != 2 {
+		t.Fatalf("manifest lists %v files, want 2", len(manifest.Files))
+	}
+
+	stats, err := Import(dst, bytes.NewReader(archive.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// two series entries and the stays of Alice and Bob
+	if stats.Files != 2 || stats.Created != 2 || stats.Entries != 4 || stats.Skipped != 0 {
+		t.Errorf("first import %+v", stats)
+	}
+	for _, name := range []string{"rp.json.gz", "roster.json.gz"} {
+		path := filepath.Join("guild", "kn", "knights", name)
+		a, err := readGzip(filepath.Join(src, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := readGzip(filepath.Join(dst, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(a, b) {
+			t.Errorf("%v differs after the round trip:\n%s\n%s", path, a, b)
+		}
+	}
+
+	stats, err = Import(dst, bytes.NewReader(archive.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Created != 0 || stats.Entries != 0 || stats.Skipped != 4 {
+		t.Errorf("second import %+v", stats)
+	}
+}
+
+// tamper rewrites the archive with the content of the first series
+// changed.
+func tamper(t *testing.T, archive []byte) []byte {
+	t.Helper()
+	gReader, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tReader := tar.NewReader(gReader)
+	out := &bytes.Buffer{}
+	gWriter := gzip.NewWriter(out)
+	tWriter := tar.NewWriter(gWriter)
+	tampered := false
+	for {
+		header, err := tReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(tReader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !tampered && strings.HasSuffix(header.Name, "rp.json") {
+			data = bytes.Replace(data, []byte("20"), []byte("99"), 1)
+			tampered = true
+		}
+		header.Size = int64(len(data))
+		tWriter.WriteHeader(header)
+		tWriter.Write(data)
+	}
+	if !tampered {
+		t.Fatal("archive has no series to tamper with")
+	}
+	tWriter.Close()
+	gWriter.Close()
+	return out.Bytes()
+}
+
+func TestArchiveTamperedChecksum(t *testing.T) {
+	t0 := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	src, dst := t.TempDir(), t.TempDir()
+	writeTestData(t, src, t0)
+
+	archive := &bytes.Buffer{}
+	if _, err := Export(src, archive); err != nil {
+		t.Fatal(err)
+	}
+	tampered := tamper(t, archive.Bytes())
+
+	if _, err := Verify(bytes.NewReader(tampered)); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("Verify = %v, want a checksum mismatch", err)
+	}
+	if _, err := Import(dst, bytes.NewReader(tampered)); err == nil {
+		t.Error("tampered archive was imported")
+	}
+	entries, err := os.ReadDir(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("import of a tampered archive wrote %v", entries)
+	}
+}
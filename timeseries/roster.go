@@ -0,0 +1,225 @@
+package timeseries
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"time"
+)
+
+// Membership is a single stay of a character in a guild. A zero Joined
+// means the character was already a member when tracking started, a zero
+// Left means the character is still a member.
+type Membership struct {
+	Joined time.Time
+	Left   time.Time
+}
+
+func (m Membership) Active() bool {
+	return m.Left.IsZero()
+}
+
+// Roster records which characters have been members of a guild and when.
+type Roster struct {
+	Since   time.Time
+	Members map[string][]Membership // key: character name
+}
+
+// nextChange returns the time of the first change recorded after t. Changes
+// are only recorded at the times of updates.
+func (r *Roster) nextChange(t time.Time) (next time.Time) {
+	consider := func(c time.Time) {
+		if c.After(t) && (next.IsZero() || c.Before(next)) {
+			next = c
+		}
+	}
+	consider(r.Since)
+	for _, stays := range r.Members {
+		for _, m := range stays {
+			consider(m.Joined)
+			consider(m.Left)
+		}
+	}
+	return
+}
+
+// covers reports whether the stay includes t, a zero Joined includes
+// everything before the start of the tracking.
+func (m Membership) covers(t time.Time) bool {
+	return (m.Joined.IsZero() || !m.Joined.After(t)) && (m.Left.IsZero() || m.Left.After(t))
+}
+
+// Update records joins and leaves by comparing the current members with
+// the memberships of the roster at now. Updates older than the last
+// recorded change are merged into the history: a stay that starts or ends
+// between two updates is assumed to do so at the later one, like it would
+// have been recorded if the updates had arrived in order. Replaying a dump
+// doesn't change anything.
+func (r *Roster) Update(members []string, now time.Time) (changed bool) {
+	if r.Members == nil {
+		r.Members = make(map[string][]Membership)
+	}
+	if r.Since.IsZero() {
+		r.Since = now
+		for _, name := range members {
+			r.Members[name] = append(r.Members[name], Membership{})
+		}
+		return true
+	}
+
+	since := r.Since
+	before := now.Before(since)
+	// the next update after now, zero if there is none
+	next := r.nextChange(now)
+
+	current := make(map[string]bool, len(members))
+	for _, name := range members {
+		current[name] = true
+		if _, ok := r.Members[name]; !ok {
+			r.Members[name] = nil
+		}
+	}
+
+	for name, stays := range r.Members {
+		c := -1
+		for i, m := range stays {
+			if m.covers(now) {
+				c = i
+				break
+			}
+		}
+
+		switch {
+		case current[name] && c < 0:
+			m := Membership{Joined: now, Left: next}
+			if before {
+				// a member when the tracking starts now
+				m.Joined = time.Time{}
+			}
+			joined := false
+			for i := range stays {
+				if !next.IsZero() && stays[i].Joined.Equal(next) {
+					// still a member at the next update
+					stays[i].Joined = m.Joined
+					joined = true
+				}
+			}
+			if !joined {
+				stays = append(stays, m)
+			}
+			changed = true
+		case !current[name] && c >= 0:
+			m := stays[c]
+			if m.Joined.IsZero() && before {
+				// joined by the former start of the tracking
+				stays[c].Joined = since
+			} else {
+				stays[c].Left = now
+				if !next.IsZero() && (m.Left.IsZero() || m.Left.After(next)) {
+					// a member again at the next update
+					stays = append(stays, Membership{Joined: next, Left: m.Left})
+				}
+			}
+			changed = true
+		}
+		sort.Slice(stays, func(a, b int) bool { return stays[a].Joined.Before(stays[b].Joined) })
+		r.Members[name] = stays
+	}
+	if before {
+		r.Since = now
+		changed = true
+	}
+	return
+}
+
+// MembershipsBetween returns the stays of every character that overlap
+// the given window, clipped to the window.
+func (r *Roster) MembershipsBetween(from, to time.Time) map[string][]Membership {
+	results := make(map[string][]Membership)
+	for name, stays := range r.Members {
+		for _, m := range stays {
+			if !m.Left.IsZero() && !m.Left.After(from) {
+				continue
+			}
+			if m.Joined.After(to) {
+				continue
+			}
+			if m.Joined.Before(from) {
+				m.Joined = from
+			}
+			if m.Left.IsZero() || m.Left.After(to) {
+				m.Left = to
+			}
+			results[name] = append(results[name], m)
+		}
+	}
+	return results
+}
+
+func OpenRoster(filename string) *Roster {
+	r := &Roster{}
+	fh, err := os.Open(filename)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Println(err)
+		}
+		return nil
+	}
+	defer fh.Close()
+
+	gReader, err := gzip.NewReader(fh)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	defer gReader.Close()
+
+	data, err := ioutil.ReadAll(gReader)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	err = json.Unmarshal(data, r)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	return r
+}
+
+func (r *Roster) Save(filename string) error {
+	ensureDir(filename)
+	fh, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	gWriter := gzip.NewWriter(fh)
+	defer gWriter.Close()
+
+	bytes, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	gWriter.Write(bytes)
+	return nil
+}
+
+func UpdateRoster(fn string, members []string, now time.Time) error {
+	r := OpenRoster(fn)
+	if r == nil {
+		r = &Roster{}
+	}
+	if r.Update(members, now) {
+		return countWrite(r.Save(fn))
+	}
+	return nil
+}
+
+func GuildRoster(guildName string) *Roster {
+	return OpenRoster(TimeSeriesPath("guild", guildName, "roster"))
+}
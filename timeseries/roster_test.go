@@ -0,0 +1,129 @@
+package timeseries
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRosterUpdate(t *testing.T) {
+	t0 := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	r := &Roster{}
+
+	if !r.Update([]string{"Alice", "Bob"}, t0) {
+		t.Fatal("first update did not change the roster")
+	}
+	if !r.Since.Equal(t0) {
+		t.Errorf("Since = %v, want %v", r.Since, t0)
+	}
+	if r.Update([]string{"Alice", "Bob"}, t0.Add(time.Hour)) {
+		t.Error("update without joins or leaves changed the roster")
+	}
+	// Bob leaves, Carol joins
+	r.Update([]string{"Alice", "Carol"}, t0.Add(2*time.Hour))
+	// Bob rejoins
+	r.Update([]string{"Alice", "Bob", "Carol"}, t0.Add(3*time.Hour))
+
+	want := map[string][]Membership{
+		"Alice": {{}},
+		"Bob":   {{Left: t0.Add(2 * time.Hour)}, {Joined: t0.Add(3 * time.Hour)}},
+		"Carol": {{Joined: t0.Add(2 * time.Hour)}},
+	}
+	if len(r.Members) != len(want) {
+		t.Fatalf("roster has %v members, want %v", len(r.Members), len(want))
+	}
+	for name, stays := range want {
+		got := r.Members[name]
+		if len(got) != len(stays) {
+			t.Errorf("%v: %v stays, want %v", name, len(got), len(stays))
+			continue
+		}
+		for i := range stays {
+			if !got[i].Joined.Equal(stays[i].Joined) || !got[i].Left.Equal(stays[i].Left) {
+				t.Errorf("%v: stay %v = %+v, want %+v", name, i, got[i], stays[i])
+			}
+		}
+	}
+}
+
+func TestRosterMembershipsBetween(t *testing.T) {
+	t0 := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	r := &Roster{}
+	r.Update([]string{"Alice", "Bob"}, t0)
+	r.Update([]string{"Alice"}, t0.Add(2*time.Hour))
+	r.Update([]string{"Alice", "Bob"}, t0.Add(4*time.Hour))
+
+	from, to := t0.Add(time.Hour), t0.Add(5*time.Hour)
+	stays := r.MembershipsBetween(from, to)
+	if got := stays["Alice"]; len(got) != 1 || !got[0].Joined.Equal(from) || !got[0].Left.Equal(to) {
+		t.Errorf("Alice: %+v", got)
+	}
+	bob := stays["Bob"]
+	if len(bob) != 2 {
+		t.Fatalf("Bob: %+v", bob)
+	}
+	if !bob[0].Joined.Equal(from) || !bob[0].Left.Equal(t0.Add(2*time.Hour)) {
+		t.Errorf("Bob first stay: %+v", bob[0])
+	}
+	if !bob[1].Joined.Equal(t0.Add(4*time.Hour)) || !bob[1].Left.Equal(to) {
+		t.Errorf("Bob second stay: %+v", bob[1])
+	}
+}
+
+func permutations(n int) [][]int {
+	if n == 0 {
+		return [][]int{{}}
+	}
+	results := make([][]int, 0)
+	for _, p := range permutations(n - 1) {
+		for i := 0; i <= len(p); i++ {
+			q := append(append(append([]int{}, p[:i]...), n-1), p[i:]...)
+			results = append(results, q)
+		}
+	}
+	return results
+}
+
+func TestRosterUpdateOutOfOrder(t *testing.T) {
+	t0 := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	updates := [][]string{
+		{"Alice", "Bob"},
+		{"Alice"},
+		{"Alice", "Bob", "Carol"},
+		{"Alice", "Carol"},
+		{"Bob"},
+	}
+	inOrder := &Roster{}
+	for i, members := range updates {
+		inOrder.Update(members, t0.Add(time.Duration(i)*time.Hour))
+	}
+
+	for _, order := range permutations(len(updates)) {
+		r := &Roster{}
+		for _, i := range order {
+			r.Update(updates[i], t0.Add(time.Duration(i)*time.Hour))
+		}
+		if !r.Since.Equal(inOrder.Since) || len(r.Members) != len(inOrder.Members) {
+			t.Errorf("order %v: roster since %v with %v members", order, r.Since, len(r.Members))
+			continue
+		}
+		for name, want := range inOrder.Members {
+			got := r.Members[name]
+			if len(got) != len(want) {
+				t.Errorf("order %v: %v has stays %+v, want %+v", order, name, got, want)
+				continue
+			}
+			for i := range want {
+				if !got[i].Joined.Equal(want[i].Joined) || !got[i].Left.Equal(want[i].Left) {
+					t.Errorf("order %v: %v has stays %+v, want %+v", order, name, got, want)
+					break
+				}
+			}
+		}
+		// replaying changes nothing
+		for _, i := range order {
+			if r.Update(updates[i], t0.Add(time.Duration(i)*time.Hour)) {
+				t.Errorf("order %v: replaying update %v changed the roster", order, i)
+			}
+		}
+	}
+}
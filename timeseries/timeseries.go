@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -111,21 +112,59 @@ func (t *TimeSeries) EntriesSince(date time.Time) []TimeSeriesEntry {
 	}
 	return results
 }
+
+// ValueSince returns how much the value changed after date.
 func (t *TimeSeries) ValueSince(date time.Time) int64 {
-	series := t.EntriesSince(date)
+	return delta(t.Entries, date)
+}
+
+// ValueBetween is like ValueSince but ignores entries recorded after to.
+func (t *TimeSeries) ValueBetween(from, to time.Time) int64 {
+	i := sort.Search(len(t.Entries), func(i int) bool {
+		return t.Entries[i].Timestamp.After(to)
+	})
+	return delta(t.Entries[:i], from)
+}
+
+// delta returns the difference between the last entry of the sorted series
+// and the value at from, which is the last entry recorded at or before
+// from. Series that start after from are measured from their first entry,
+// so a single entry without an earlier one counts as no change.
+func delta(series []TimeSeriesEntry, from time.Time) int64 {
 	l := len(series)
-	if l == 0 {
+	if l == 0 || !series[l-1].Timestamp.After(from) {
 		return 0
-	} else if l == 1 {
-		return int64(series[0].Value)
-	} else {
-		first := series[0]
-		last := series[l-1]
-		if first.Timestamp.Before(last.Timestamp) {
-			return int64(last.Value) - int64(first.Value)
+	}
+	i := sort.Search(l, func(i int) bool {
+		return series[i].Timestamp.After(from)
+	})
+	if i > 0 {
+		i -= 1
+	}
+	return int64(series[l-1].Value) - int64(series[i].Value)
+}
+
+// ValueAt returns the value of the last entry recorded at or before date.
+func (t *TimeSeries) ValueAt(date time.Time) (value uint64, ok bool) {
+	i := sort.Search(len(t.Entries), func(i int) bool {
+		return t.Entries[i].Timestamp.After(date)
+	})
+	if i == 0 {
+		return 0, false
+	}
+	return t.Entries[i-1].Value, true
+}
+
+// Changes returns the timestamps of all entries whose value differs from
+// the entry before them.
+func (t *TimeSeries) Changes() []time.Time {
+	results := make([]time.Time, 0)
+	for i := 1; i < len(t.Entries); i++ {
+		if t.Entries[i].Value != t.Entries[i-1].Value {
+			results = append(results, t.Entries[i].Timestamp)
 		}
-		return int64(first.Value) - int64(last.Value)
 	}
+	return results
 }
 
 func OpenOrCreateTimeseries(filename string) *TimeSeries {
@@ -211,6 +250,9 @@ func ensureDir(path string) {
 	os.MkdirAll(dir, os.ModePerm)
 }
 
+// TimeSeriesPath derives the file of a series from the name as it appears
+// in the dump. Callers resolve user supplied names to those first, changing
+// the derivation would orphan the existing series.
 func TimeSeriesPath(queryType, metric, key string) string {
 	metric = strings.ToLower(metric)
 	key = strings.ToLower(key)
@@ -223,15 +265,35 @@ func TimeSeriesPath(queryType, metric, key string) string {
 	return filepath.Join("data", queryType, sm, metric, key+".json.gz")
 }
 
+// number of series saved by UpdateSeries and UpdateRoster and of failed
+// attempts
+var writes, writeErrors uint64
+
+func countWrite(err error) error {
+	if err != nil {
+		atomic.AddUint64(&writeErrors, 1)
+	} else {
+		atomic.AddUint64(&writes, 1)
+	}
+	return err
+}
+
+// WriteCounts returns how many series updates have been saved and how many
+// failed since the start.
+func WriteCounts() (written, failed uint64) {
+	return atomic.LoadUint64(&writes), atomic.LoadUint64(&writeErrors)
+}
+
 func UpdateSeries(fn string, value uint64, timestamp time.Time) (err error) {
 	ts := OpenOrCreateTimeseries(fn)
 	if ts == nil {
 		log.Printf("Failed to create ts for: %v", fn)
+		atomic.AddUint64(&writeErrors, 1)
 		return
 	}
 	changed := ts.Append(value, timestamp)
 	if changed {
-		err = ts.Save(fn)
+		err = countWrite(ts.Save(fn))
 	}
 	return
 }
@@ -279,3 +341,47 @@ func GuildCountTimeSeries(guildName string) *TimeSeries {
 func RealmCountTimeSeries(realmName string) *TimeSeries {
 	return OpenTimeSeries(TimeSeriesPath("realm", realmName, "count"))
 }
+
+func ClassActiveTimeSeries(className string) *TimeSeries {
+	return OpenTimeSeries(TimeSeriesPath("class", className, "active"))
+}
+
+func GuildActiveTimeSeries(guildName string) *TimeSeries {
+	return OpenTimeSeries(TimeSeriesPath("guild", guildName, "active"))
+}
+
+func RealmActiveTimeSeries(realmName string) *TimeSeries {
+	return OpenTimeSeries(TimeSeriesPath("realm", realmName, "active"))
+}
+
+func ClassLWRPTimeSeries(className string) *TimeSeries {
+	return OpenTimeSeries(TimeSeriesPath("class", className, "lwrp"))
+}
+
+func ClassRPPerActiveTimeSeries(className string) *TimeSeries {
+	return OpenTimeSeries(TimeSeriesPath("class", className, "rpperactive"))
+}
+
+func ClassTopGainersTimeSeries(className string) *TimeSeries {
+	return OpenTimeSeries(TimeSeriesPath("class", className, "topgainers"))
+}
+
+func CharacterRankTimeSeries(characterName string) *TimeSeries {
+	return OpenTimeSeries(TimeSeriesPath("character", characterName, "rank"))
+}
+
+func CharacterRealmRankTimeSeries(characterName string) *TimeSeries {
+	return OpenTimeSeries(TimeSeriesPath("character", characterName, "rank_realm"))
+}
+
+func CharacterClassRankTimeSeries(characterName string) *TimeSeries {
+	return OpenTimeSeries(TimeSeriesPath("character", characterName, "rank_class"))
+}
+
+func GuildRankTimeSeries(guildName string) *TimeSeries {
+	return OpenTimeSeries(TimeSeriesPath("guild", guildName, "rank"))
+}
+
+func GuildRealmRankTimeSeries(guildName string) *TimeSeries {
+	return OpenTimeSeries(TimeSeriesPath("guild", guildName, "rank_realm"))
+}
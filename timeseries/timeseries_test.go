@@ -0,0 +1,70 @@
+package timeseries
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValueBetween(t *testing.T) {
+	t0 := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	at := func(hours int) time.Time { return t0.Add(time.Duration(hours) * time.Hour) }
+	series := func(values ...uint64) *TimeSeries {
+		// one entry every 24 hours, starting at t0
+		ts := &TimeSeries{}
+		for i, v := range values {
+			ts.Append(v, at(24*i))
+		}
+		return ts
+	}
+
+	for _, c := range []struct {
+		name     string
+		ts       *TimeSeries
+		from, to time.Time
+		want     int64
+	}{
+		{"empty series", series(), at(0), at(100), 0},
+		{"no entry in the window", series(100, 200), at(30), at(40), 0},
+		{"window before the series", series(100, 200), at(-48), at(-24), 0},
+		{"single entry without an earlier one", series(100), at(-1), at(10), 0},
+		{"single entry with an earlier one", series(2000000, 2000500), at(12), at(30), 500},
+		{"several entries with an earlier one", series(100, 150, 175, 300), at(12), at(60), 75},
+		{"several entries without an earlier one", series(100, 150, 175), at(-12), at(60), 75},
+		{"window starts at an entry", series(100, 150, 175), at(24), at(48), 25},
+		{"window starts between entries", series(100, 150, 175, 300), at(36), at(100), 150},
+		{"entries after the window are ignored", series(100, 150, 175, 300), at(0), at(50), 75},
+	} {
+		if got := c.ts.ValueBetween(c.from, c.to); got != c.want {
+			t.Errorf("%v: ValueBetween = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestValueSince(t *testing.T) {
+	t0 := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	ts := &TimeSeries{}
+	ts.Append(2000000, t0)
+	ts.Append(2000500, t0.Add(70*time.Hour))
+
+	if got := ts.ValueSince(t0.Add(48 * time.Hour)); got != 500 {
+		t.Errorf("ValueSince = %v, want 500", got)
+	}
+	if got := ts.ValueSince(t0.Add(71 * time.Hour)); got != 0 {
+		t.Errorf("ValueSince after the last entry = %v, want 0", got)
+	}
+}
+
+func TestTimeSeriesPath(t *testing.T) {
+	// the derivation must not change, existing series would be orphaned
+	for _, c := range []struct {
+		metric, want string
+	}{
+		{"Knights of Albion", "data/guild/kn/knights of albion/rp.json.gz"},
+		{" Padded ", "data/guild/ p/ padded /rp.json.gz"},
+		{"X", "data/guild/x/x/rp.json.gz"},
+	} {
+		if got := TimeSeriesPath("guild", c.metric, "rp"); got != c.want {
+			t.Errorf("TimeSeriesPath(%q) = %q, want %q", c.metric, got, c.want)
+		}
+	}
+}
@@ -42,6 +42,15 @@ func UpdateTimeseries(statistics *Statistics, now time.Time) {
 					log.Printf("Failed to save TS for %v: %v", guildName, err)
 				}
 			}
+
+			members := make([]string, 0, len(query.Characters))
+			for characterName := range query.Characters {
+				members = append(members, characterName)
+			}
+			path := timeseries.TimeSeriesPath("guild", guildName, "roster")
+			if err := timeseries.UpdateRoster(path, members, now); err != nil {
+				log.Printf("Failed to save roster for %v: %v", guildName, err)
+			}
 		}
 		wg.Done()
 	}()
@@ -52,7 +61,7 @@ func UpdateTimeseries(statistics *Statistics, now time.Time) {
 		for realm, query := range statistics.ByRealm {
 			metrics := []Item{
 				{"count", uint64(len(query.Characters))},
-				{"xp", query.TotalRP},
+				{"xp", query.TotalXP},
 				{"rp", query.TotalRP},
 			}
 			for _, metric := range metrics {
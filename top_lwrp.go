@@ -8,8 +8,13 @@ import (
 	"github.com/andir/UthgardCommunityHeraldBackend/timeseries"
 )
 
-func UpdateTopLWRP(stats *Statistics) {
-	lw := time.Now().Add(-24 * 8 * time.Hour)
+// UpdateTopLWRP calculates the RP and XP gained in the week before now by
+// every character, guild, class and realm and ranks them by it.
+func UpdateTopLWRP(stats *Statistics, now time.Time) {
+	if now.IsZero() {
+		now = time.Now()
+	}
+	lw := now.Add(-24 * 8 * time.Hour)
 	log.Println("Calculating Character LWRP")
 
 	stats.LWRPCharacters = make(CharactersByLWRP, 0)
@@ -17,9 +22,9 @@ func UpdateTopLWRP(stats *Statistics) {
 
 	for _, char := range stats.Characters {
 		ts := timeseries.CharacterRPTimeSeries(char.Name)
-		lwrp := ts.ValueSince(lw)
+		lwrp := ts.ValueBetween(lw, now)
 		ts = timeseries.CharacterXPTimeSeries(char.Name)
-		lwxp := ts.ValueSince(lw)
+		lwxp := ts.ValueBetween(lw, now)
 		char.LastWeekRp = lwrp
 		char.LastWeekXp = lwxp
 		if lwxp > 10000000000 {
@@ -43,9 +48,9 @@ func UpdateTopLWRP(stats *Statistics) {
 			continue
 		}
 		ts := timeseries.GuildRPTimeSeries(guildName)
-		lwrp := ts.ValueSince(lw)
+		lwrp := ts.ValueBetween(lw, now)
 		ts = timeseries.GuildXPTimeSeries(guildName)
-		lwxp := ts.ValueSince(lw)
+		lwxp := ts.ValueBetween(lw, now)
 
 		guild.LWRP = lwrp
 		guild.LWXP = lwxp
@@ -62,9 +67,9 @@ func UpdateTopLWRP(stats *Statistics) {
 	log.Println("calculating Class LWRP/XP")
 	for className, query := range stats.ByClass {
 		ts := timeseries.ClassRPTimeSeries(className)
-		lwrp := ts.ValueSince(lw)
+		lwrp := ts.ValueBetween(lw, now)
 		ts = timeseries.ClassXPTimeSeries(className)
-		lwxp := ts.ValueSince(lw)
+		lwxp := ts.ValueBetween(lw, now)
 
 		query.LWRP = lwrp
 		query.LWXP = lwxp
@@ -74,9 +79,9 @@ func UpdateTopLWRP(stats *Statistics) {
 	log.Println("calculating realm LWRP/XP")
 	for realmName, query := range stats.ByRealm {
 		ts := timeseries.RealmRPTimeSeries(realmName)
-		lwrp := ts.ValueSince(lw)
+		lwrp := ts.ValueBetween(lw, now)
 		ts = timeseries.RealmXPTimeSeries(realmName)
-		lwxp := ts.ValueSince(lw)
+		lwxp := ts.ValueBetween(lw, now)
 		query.LWRP = lwrp
 		query.LWXP = lwxp
 	}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andir/UthgardCommunityHeraldBackend/search"
+	radix "github.com/armon/go-radix"
+)
+
+const (
+	SearchTypeCharacter = "character"
+	SearchTypeGuild     = "guild"
+	SearchTypeClass     = "class"
+	SearchTypeRace      = "race"
+
+	MAX_SEARCH_CACHE = 10000
+)
+
+var searchTypes = []string{SearchTypeCharacter, SearchTypeGuild, SearchTypeClass, SearchTypeRace}
+
+// SearchItem is a typed search result with a short summary of the entity.
+type SearchItem struct {
+	Type  string
+	Name  string
+	Realm string `json:",omitempty"`
+	Class string `json:",omitempty"`
+	Guild string `json:",omitempty"`
+	Level int    `json:",omitempty"`
+	RP    uint64
+	// number of characters of guilds, classes and races
+	Count int `json:",omitempty"`
+	Match string
+	Score int
+}
+
+// NewClassRaceIndex indexes all classes and races with their summaries.
+func NewClassRaceIndex(stats *Statistics) *search.Index {
+	items := make(map[string]*SearchItem)
+	add := func(itemType, name string, char *Character) {
+		key := itemType + "/" + name
+		item, ok := items[key]
+		if !ok {
+			item = &SearchItem{
+				Type:  itemType,
+				Name:  name,
+				Realm: char.Realm,
+			}
+			items[key] = item
+		}
+		item.Count += 1
+		item.RP += char.Rp
+	}
+	for _, char := range stats.Characters {
+		add(SearchTypeClass, char.Class, char)
+		add(SearchTypeRace, char.Race, char)
+	}
+
+	index := search.NewIndex()
+	for _, item := range items {
+		if item.Name != "" {
+			index.Add(item.Name, item)
+		}
+	}
+	index.Build()
+	return index
+}
+
+// BuildSearch creates the prefix trees and search indexes of a snapshot.
+func BuildSearch(stats *Statistics) {
+	wg := &sync.WaitGroup{}
+	wg.Add(3)
+	go func() {
+		ctree := radix.New()
+		cindex := search.NewIndex()
+		for name, character := range stats.Characters {
+			ctree.Insert(search.Fold(name), character)
+			cindex.Add(character.Name, character)
+		}
+		cindex.Build()
+		stats.CharacterTree = ctree
+		stats.CharacterIndex = cindex
+		wg.Done()
+	}()
+	go func() {
+		gtree := radix.New()
+		gindex := search.NewIndex()
+		for name := range stats.ByGuild {
+			gtree.Insert(search.Fold(name), name)
+			if name != "" {
+				gindex.Add(name, name)
+			}
+		}
+		gindex.Build()
+		stats.GuildTree = gtree
+		stats.GuildIndex = gindex
+		wg.Done()
+	}()
+	go func() {
+		stats.ClassRaceIndex = NewClassRaceIndex(stats)
+		wg.Done()
+	}()
+	wg.Wait()
+}
+
+func characterSearchItem(char *Character) *SearchItem {
+	return &SearchItem{
+		Type:  SearchTypeCharacter,
+		Name:  char.Name,
+		Realm: char.Realm,
+		Class: char.Class,
+		Guild: char.Guild,
+		Level: char.Level,
+		RP:    char.Rp,
+	}
+}
+
+func guildSearchItem(stats *Statistics, name string) *SearchItem {
+	item := &SearchItem{
+		Type: SearchTypeGuild,
+		Name: name,
+	}
+	if guild, ok := stats.Guilds[name]; ok {
+		item.RP = guild.RP
+	}
+	if query, ok := stats.ByGuild[name]; ok {
+		item.Count = len(query.Characters)
+		for _, char := range query.Characters {
+			item.Realm = char.Realm
+			break
+		}
+	}
+	return item
+}
+
+// searchCache keeps the results of recent searches of the current
+// snapshot, autocompletion tends to repeat the same queries a lot.
+type searchCache struct {
+	lock       sync.Mutex
+	generation int64
+	results    map[string][]SearchItem
+}
+
+func (c *searchCache) get(generation int64, key string) ([]SearchItem, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.generation != generation {
+		return nil, false
+	}
+	results, ok := c.results[key]
+	return results, ok
+}
+
+func (c *searchCache) put(generation int64, key string, results []SearchItem) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.generation != generation || len(c.results) >= MAX_SEARCH_CACHE {
+		c.generation = generation
+		c.results = make(map[string][]SearchItem)
+	}
+	c.results[key] = results
+}
+
+var unifiedSearchCache = &searchCache{}
+
+// UnifiedSearch searches characters, guilds, classes and races at once and
+// returns the limit best matches of the given types.
+func UnifiedSearch(stats *Statistics, q string, types []string, limit int) []SearchItem {
+	key := strings.Join(types, ",") + "/" + search.Normalize(q) + "/" + strconv.Itoa(limit)
+	if results, ok := unifiedSearchCache.get(stats.Generation, key); ok {
+		return results
+	}
+
+	wanted := make(map[string]bool)
+	for _, t := range types {
+		wanted[t] = true
+	}
+
+	results := make([]SearchItem, 0)
+	if wanted[SearchTypeCharacter] {
+		for _, r := range stats.CharacterIndex.Search(q, limit) {
+			if char, ok := r.Value.(*Character); ok {
+				item := characterSearchItem(char)
+				item.Match, item.Score = r.Match, r.Score
+				results = append(results, *item)
+			}
+		}
+	}
+	if wanted[SearchTypeGuild] {
+		for _, r := range stats.GuildIndex.Search(q, limit) {
+			item := guildSearchItem(stats, r.Name)
+			item.Match, item.Score = r.Match, r.Score
+			results = append(results, *item)
+		}
+	}
+	if wanted[SearchTypeClass] || wanted[SearchTypeRace] {
+		for _, r := range stats.ClassRaceIndex.Search(q, limit) {
+			if item, ok := r.Value.(*SearchItem); ok && wanted[item.Type] {
+				i := *item
+				i.Match, i.Score = r.Match, r.Score
+				results = append(results, i)
+			}
+		}
+	}
+
+	sort.SliceStable(results, func(a, b int) bool {
+		if results[a].Score != results[b].Score {
+			return results[a].Score > results[b].Score
+		}
+		return results[a].RP > results[b].RP
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	unifiedSearchCache.put(stats.Generation, key, results)
+	return results
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestUnifiedSearch(t *testing.T) {
+	unifiedSearchCache = &searchCache{}
+	stats := LoadCharacters(map[string]*Character{
+		"Mera":  {Name: "Mera", Class: "Cleric", Guild: "Merchants", Rp: 100},
+		"Merb":  {Name: "Merb", Class: "Cleric", Rp: 500},
+		"Bob":   {Name: "Bob", Class: "Mercenary", Rp: 3000},
+		"Humer": {Name: "Humer", Class: "Cleric", Rp: 9000},
+	})
+	stats.Generation = 1
+	BuildSearch(stats)
+
+	names := func(items []SearchItem) []string {
+		n := make([]string, len(items))
+		for i, item := range items {
+			n[i] = item.Type + "/" + item.Name
+		}
+		return n
+	}
+	check := func(got []SearchItem, want ...string) {
+		t.Helper()
+		g := names(got)
+		if len(g) != len(want) {
+			t.Fatalf("got %v, want %v", g, want)
+		}
+		for i := range want {
+			if g[i] != want[i] {
+				t.Fatalf("got %v, want %v", g, want)
+			}
+		}
+	}
+
+	// better matches first, equal scores ordered by RP across types
+	check(UnifiedSearch(stats, "mer", searchTypes, 10),
+		"character/Merb", "character/Mera", "class/Mercenary", "guild/Merchants", "character/Humer")
+	check(UnifiedSearch(stats, "mer", []string{SearchTypeGuild}, 10), "guild/Merchants")
+	check(UnifiedSearch(stats, "mer", searchTypes, 2), "character/Merb", "character/Mera")
+
+	// results are cached for the snapshot
+	stats.CharacterIndex = nil
+	check(UnifiedSearch(stats, "MER ", searchTypes, 2), "character/Merb", "character/Mera")
+
+	// and forgotten by the next one
+	next := LoadCharacters(map[string]*Character{
+		"Merc": {Name: "Merc", Class: "Cleric", Rp: 1},
+	})
+	next.Generation = 2
+	BuildSearch(next)
+	check(UnifiedSearch(next, "mer", searchTypes, 2), "character/Merc")
+}
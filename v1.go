@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const V1_PREFIX = "/v1"
+
+type Pagination struct {
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+	Total  int `json:"total"`
+}
+
+// Envelope wraps every response of the versioned API.
+type Envelope struct {
+	Data          interface{} `json:"data"`
+	Error         string      `json:"error,omitempty"`
+	Generation    int64       `json:"generation"`
+	Fetched       time.Time   `json:"fetched"`
+	DumpTimestamp time.Time   `json:"dumpTimestamp"`
+	Pagination    *Pagination `json:"pagination,omitempty"`
+}
+
+// lowerCamel converts Go field names to lowerCamel, treating runs of
+// capitals as one word: RP and Rp become rp, RPShare becomes rpShare.
+func lowerCamel(name string) string {
+	r := []rune(name)
+	n := 0
+	for n < len(r) && unicode.IsUpper(r[n]) {
+		n++
+	}
+	if n > 1 && n < len(r) {
+		// the last capital starts the next word
+		n--
+	}
+	for i := 0; i < n; i++ {
+		r[i] = unicode.ToLower(r[i])
+	}
+	return string(r)
+}
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// v1Value converts a response of the legacy API into the generic values
+// of the versioned API. Struct fields are renamed to lowerCamel while map
+// keys, which are names of characters, guilds and the like, are kept.
+func v1Value(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	if v.Type().Implements(jsonMarshalerType) {
+		return v.Interface()
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return v1Value(v.Elem())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return []interface{}{}
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface()
+		}
+		results := make([]interface{}, v.Len())
+		for i := range results {
+			results[i] = v1Value(v.Index(i))
+		}
+		return results
+	case reflect.Map:
+		results := make(map[string]interface{}, v.Len())
+		for _, key := range v.MapKeys() {
+			results[fmt.Sprint(key.Interface())] = v1Value(v.MapIndex(key))
+		}
+		return results
+	case reflect.Struct:
+		results := make(map[string]interface{})
+		v1Fields(v, results)
+		return results
+	}
+	return v.Interface()
+}
+
+func v1Fields(v reflect.Value, results map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		if f.Anonymous && tag == "" {
+			fv := v.Field(i)
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				v1Fields(fv, results)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+
+		name := f.Name
+		options := strings.Split(tag, ",")
+		if options[0] != "" {
+			name = options[0]
+		}
+		fv := v.Field(i)
+		omitempty := false
+		for _, option := range options[1:] {
+			omitempty = omitempty || option == "omitempty"
+		}
+		if omitempty && isEmpty(fv) {
+			continue
+		}
+		results[lowerCamel(name)] = v1Value(fv)
+	}
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return v.IsZero()
+}
+
+// number of list entries of a page unless a limit is requested
+const V1_PAGE_SIZE = 100
+
+// parsePagination reads the "offset" and "limit" query parameters.
+func parsePagination(req *http.Request) (offset, limit int, err error) {
+	query := req.URL.Query()
+	limit = V1_PAGE_SIZE
+	if val := query.Get("offset"); val != "" {
+		offset, err = strconv.Atoi(val)
+		if err != nil || offset < 0 {
+			return 0, 0, &HTTPError{http.StatusBadRequest, fmt.Sprintf("invalid offset %v", val)}
+		}
+	}
+	if val := query.Get("limit"); val != "" {
+		limit, err = strconv.Atoi(val)
+		if err != nil || limit < 0 {
+			return 0, 0, &HTTPError{http.StatusBadRequest, fmt.Sprintf("invalid limit %v", val)}
+		}
+	}
+	return offset, limit, nil
+}
+
+// unpaginated returns a copy of the request that asks the endpoint for all
+// results, the pagination of the versioned API owns offset and limit.
+func unpaginated(req *http.Request) *http.Request {
+	inner := req.Clone(req.Context())
+	query := inner.URL.Query()
+	query.Del("offset")
+	query.Set("limit", strconv.Itoa(MAX_RESULTS))
+	inner.URL.RawQuery = query.Encode()
+	return inner
+}
+
+// paginate returns the page of list responses, other responses are
+// returned as they are.
+func paginate(data interface{}, offset, limit int) (interface{}, *Pagination) {
+	list, ok := data.([]interface{})
+	if !ok {
+		return data, nil
+	}
+	p := &Pagination{
+		Offset: min(offset, len(list)),
+		Total:  len(list),
+	}
+	p.Limit = min(limit, len(list)-p.Offset)
+	return list[p.Offset : p.Offset+p.Limit], p
+}
+
+func v1EndpointWrapper(fun APIFunction) http.HandlerFunc {
+	return http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		stats := statistics
+		if stats == nil {
+			writeNotReady(wr)
+			json.NewEncoder(wr).Encode(&Envelope{Error: NOT_READY})
+			return
+		}
+		if writeNotModified(stats, wr, req) {
+			return
+		}
+		envelope := &Envelope{
+			Generation:    stats.Generation,
+			Fetched:       stats.Fetched,
+			DumpTimestamp: stats.LastUpdated,
+		}
+
+		var response, err interface{}
+		offset, limit, perr := parsePagination(req)
+		if perr != nil {
+			err = perr
+		} else {
+			response, err = fun(wr, unpaginated(req))
+		}
+		if err == nil {
+			envelope.Data, envelope.Pagination = paginate(v1Value(reflect.ValueOf(response)), offset, limit)
+		}
+
+		wr.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if err != nil {
+			log.Println(err)
+			envelope.Data = nil
+			envelope.Error = errorMessage(err)
+			wr.WriteHeader(errorStatus(err))
+		} else {
+			setCacheHeaders(stats, wr, req)
+			wr.WriteHeader(http.StatusOK)
+		}
+		json.NewEncoder(wr).Encode(envelope)
+	})
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestV1Pagination(t *testing.T) {
+	old := statistics
+	defer func() { statistics = old }()
+	statistics = &Statistics{Generation: 1}
+
+	const total = 250
+	handler := v1EndpointWrapper(func(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
+		if req.URL.Query().Get("offset") != "" {
+			t.Errorf("offset passed to the endpoint: %v", req.URL)
+		}
+		limit, err := parseLimit(req, 10)
+		if err != nil {
+			return nil, err
+		}
+		results := make([]int, 0)
+		for i := 0; i < total && i < limit; i++ {
+			results = append(results, i)
+		}
+		return results, nil
+	})
+
+	var seen []int
+	for offset := 0; offset < total; offset += 100 {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/v1/test?limit=100&offset="+strconv.Itoa(offset), nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("offset %v: status %v: %v", offset, rec.Code, rec.Body)
+		}
+		var envelope struct {
+			Data       []int
+			Pagination Pagination
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil {
+			t.Fatal(err)
+		}
+		p := envelope.Pagination
+		if p.Total != total || p.Offset != offset || p.Limit != len(envelope.Data) {
+			t.Errorf("offset %v: pagination %+v with %v entries", offset, p, len(envelope.Data))
+		}
+		seen = append(seen, envelope.Data...)
+	}
+	if len(seen) != total {
+		t.Fatalf("paged through %v entries, want %v", len(seen), total)
+	}
+	for i, v := range seen {
+		if v != i {
+			t.Fatalf("entry %v is %v", i, v)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/v1/test", nil))
+	var envelope Envelope
+	json.Unmarshal(rec.Body.Bytes(), &envelope)
+	if p := envelope.Pagination; p == nil || p.Limit != V1_PAGE_SIZE || p.Total != total {
+		t.Errorf("default page %+v", p)
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/v1/test?offset=-1", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid offset: status %v", rec.Code)
+	}
+}
+
+func TestV1Errors(t *testing.T) {
+	old := statistics
+	defer func() { statistics = old }()
+	statistics = &Statistics{Generation: 1}
+
+	for _, c := range []struct {
+		err     interface{}
+		status  int
+		message string
+	}{
+		{&HTTPError{http.StatusNotFound, "unknown webhook"}, http.StatusNotFound, "unknown webhook"},
+		{"unknown timeseries", http.StatusBadRequest, "unknown timeseries"},
+		{errors.New("open data/character/al/alice/rp.json.gz: permission denied"), http.StatusBadRequest, GENERIC_ERROR},
+	} {
+		handler := v1EndpointWrapper(func(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
+			return nil, c.err
+		})
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/v1/test", nil))
+		var envelope Envelope
+		json.Unmarshal(rec.Body.Bytes(), &envelope)
+		if rec.Code != c.status || envelope.Error != c.message {
+			t.Errorf("%v: status %v, error %q, want %v, %q", c.err, rec.Code, envelope.Error, c.status, c.message)
+		}
+	}
+
+	handler := v1EndpointWrapper(func(wr http.ResponseWriter, req *http.Request) (interface{}, interface{}) {
+		return []int{}, nil
+	})
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/v1/test?limit=x", nil))
+	var envelope Envelope
+	json.Unmarshal(rec.Body.Bytes(), &envelope)
+	if rec.Code != http.StatusBadRequest || envelope.Error != "invalid limit x" {
+		t.Errorf("invalid limit: status %v, error %q", rec.Code, envelope.Error)
+	}
+}
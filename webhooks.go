@@ -0,0 +1,621 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/andir/UthgardCommunityHeraldBackend/timeseries"
+)
+
+const (
+	WebhookFormatJSON    = "json"
+	WebhookFormatDiscord = "discord"
+
+	NotificationMilestone = "milestone"
+	NotificationLadder    = "ladder"
+	NotificationRPGain    = "rpgain"
+	NotificationTest      = "test"
+
+	WEBHOOK_MAX_ATTEMPTS = 5
+	WEBHOOK_TIMEOUT      = 10 * time.Second
+	// first delay before a failed delivery is retried, doubled with every
+	// attempt
+	WEBHOOK_BACKOFF = time.Second
+)
+
+// carrier-grade NAT, not covered by net.IP.IsPrivate
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// checkAddress rejects addresses that aren't reachable from the internet,
+// so that webhooks can't be used to reach services next to the backend.
+func checkAddress(ip net.IP) error {
+	if ip == nil {
+		return errors.New("invalid address")
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() ||
+		sharedAddressSpace.Contains(ip) || (ip.To4() != nil && ip.To4()[0] == 0) {
+		return fmt.Errorf("address %v is not public", ip)
+	}
+	return nil
+}
+
+// checkHost resolves the host of a webhook URL and checks all of its
+// addresses.
+func checkHost(host string) error {
+	if ip := net.ParseIP(host); ip != nil {
+		return checkAddress(ip)
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return err
+	}
+	for _, ip := range ips {
+		if err := checkAddress(ip); err != nil {
+			return fmt.Errorf("%v: %v", host, err)
+		}
+	}
+	return nil
+}
+
+// publicDialer checks the address of every connection again, the DNS
+// records of a host may have changed since it was registered and
+// redirects may point anywhere.
+func publicDialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout: WEBHOOK_TIMEOUT,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			return checkAddress(net.ParseIP(host))
+		},
+	}
+}
+
+// Webhook is a registered receiver for notifications about the watched
+// characters and guilds.
+type Webhook struct {
+	ID     string
+	URL    string
+	Format string
+	// used to sign every delivery with HMAC-SHA256
+	Secret string
+
+	Characters []string
+	Guilds     []string
+
+	// event types of milestones to forward, empty means all
+	EventTypes []string
+	// notify when a watched character or guild enters or leaves the top
+	// TopN of the RP ladder, 0 disables it
+	TopN int
+	// notify when a watched character or guild gained more than RPGain
+	// within RPGainWindow, 0 disables it
+	RPGain       int64
+	RPGainWindow string
+
+	Created time.Time
+	// key: lower case character or guild name
+	LastRPGain map[string]time.Time `json:",omitempty"`
+}
+
+func (w *Webhook) Validate() error {
+	u, err := url.Parse(w.URL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("webhook URL must be http or https")
+	}
+	if u.Hostname() == "" {
+		return errors.New("webhook URL has no host")
+	}
+	if w.Format == "" {
+		w.Format = WebhookFormatJSON
+	}
+	if w.Format != WebhookFormatJSON && w.Format != WebhookFormatDiscord {
+		return fmt.Errorf("unknown webhook format %v", w.Format)
+	}
+	if len(w.Characters) == 0 && len(w.Guilds) == 0 {
+		return errors.New("webhook doesn't watch any character or guild")
+	}
+	if w.TopN < 0 || w.TopN > MAX_RESULTS {
+		return fmt.Errorf("TopN must be between 0 and %v", MAX_RESULTS)
+	}
+	if w.RPGain > 0 {
+		if _, err := w.window(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Webhook) window() (time.Duration, error) {
+	if w.RPGainWindow == "" {
+		return 24 * time.Hour, nil
+	}
+	return time.ParseDuration(w.RPGainWindow)
+}
+
+func (w *Webhook) watchesCharacter(name string) bool {
+	for _, c := range w.Characters {
+		if strings.EqualFold(c, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Webhook) watchesGuild(name string) bool {
+	for _, g := range w.Guilds {
+		if strings.EqualFold(g, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Webhook) watchesEvent(e *Event) bool {
+	if len(w.EventTypes) > 0 {
+		found := false
+		for _, t := range w.EventTypes {
+			found = found || t == e.Type
+		}
+		if !found {
+			return false
+		}
+	}
+	if e.Character != "" && w.watchesCharacter(e.Character) {
+		return true
+	}
+	return e.Guild != "" && w.watchesGuild(e.Guild)
+}
+
+type Notification struct {
+	Type      string
+	Timestamp time.Time
+	Character string `json:",omitempty"`
+	Guild     string `json:",omitempty"`
+	Message   string
+	Event     *Event `json:",omitempty"`
+	// ladder notifications
+	TopN    int  `json:",omitempty"`
+	Rank    int  `json:",omitempty"`
+	Entered bool `json:",omitempty"`
+	// RP gain notifications
+	RP     int64  `json:",omitempty"`
+	Window string `json:",omitempty"`
+}
+
+func eventMessage(e *Event) string {
+	name := e.Character
+	if name == "" {
+		name = e.Guild
+	}
+	switch e.Type {
+	case EventLevel:
+		return fmt.Sprintf("%v reached level %v", name, e.Threshold)
+	case EventRealmRank:
+		return fmt.Sprintf("%v reached realm rank %v", name, e.Threshold)
+	case EventCharacterRP, EventGuildRP:
+		return fmt.Sprintf("%v passed %v RP", name, e.Threshold)
+	}
+	return fmt.Sprintf("%v reached %v %v", name, e.Threshold, e.Type)
+}
+
+// payload renders the body of a delivery in the format of the webhook.
+func (w *Webhook) payload(n *Notification) ([]byte, error) {
+	if w.Format == WebhookFormatDiscord {
+		return json.Marshal(struct {
+			Username string `json:"username"`
+			Content  string `json:"content"`
+		}{
+			Username: "Uthgard Herald",
+			Content:  n.Message,
+		})
+	}
+	return json.Marshal(struct {
+		Webhook      string
+		Notification *Notification
+	}{
+		Webhook:      w.ID,
+		Notification: n,
+	})
+}
+
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func randomID(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatal(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+type delivery struct {
+	ID      string
+	URL     string
+	Type    string
+	Secret  string
+	Body    []byte
+	Attempt int
+}
+
+// Webhooks holds the registered webhooks and delivers notifications to
+// them from a queue. Failed deliveries are retried with an exponential
+// backoff. Webhooks can only be registered with the token, and only for
+// public addresses.
+type Webhooks struct {
+	filename string
+	token    string
+	client   *http.Client
+	lock     sync.RWMutex
+	hooks    map[string]*Webhook // key: ID
+	queue    chan *delivery
+
+	backoff time.Duration
+	// only used by tests, which deliver to a local server
+	allowPrivate bool
+}
+
+// NewWebhooks loads the registered webhooks and starts the delivery
+// workers. Without a token registration is disabled.
+func NewWebhooks(filename, token string, workers int) *Webhooks {
+	w := loadWebhooks(filename, token)
+	w.start(workers)
+	return w
+}
+
+func loadWebhooks(filename, token string) *Webhooks {
+	w := &Webhooks{
+		filename: filename,
+		token:    token,
+		client: &http.Client{
+			Timeout: WEBHOOK_TIMEOUT,
+			Transport: &http.Transport{
+				DialContext:         publicDialer().DialContext,
+				TLSHandshakeTimeout: WEBHOOK_TIMEOUT,
+			},
+		},
+		hooks:   make(map[string]*Webhook),
+		queue:   make(chan *delivery, 1024),
+		backoff: WEBHOOK_BACKOFF,
+	}
+
+	bytes, err := ioutil.ReadFile(filename)
+	if err == nil {
+		if err := json.Unmarshal(bytes, &w.hooks); err != nil {
+			log.Printf("Failed to parse %v: %v", filename, err)
+		}
+	} else if !os.IsNotExist(err) {
+		log.Println(err)
+	}
+	return w
+}
+
+func (w *Webhooks) start(workers int) {
+	for i := 0; i < workers; i++ {
+		go w.worker()
+	}
+}
+
+func (w *Webhooks) save() error {
+	w.lock.RLock()
+	bytes, err := json.Marshal(w.hooks)
+	w.lock.RUnlock()
+	if err != nil {
+		return err
+	}
+	os.MkdirAll(filepath.Dir(w.filename), os.ModePerm)
+	return ioutil.WriteFile(w.filename, bytes, 0600)
+}
+
+// Authorized checks the bearer token of a registration request.
+func (w *Webhooks) Authorized(req *http.Request) bool {
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return w.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(w.token)) == 1
+}
+
+func (w *Webhooks) Register(hook *Webhook) error {
+	if err := hook.Validate(); err != nil {
+		return err
+	}
+	if !w.allowPrivate {
+		u, _ := url.Parse(hook.URL)
+		if err := checkHost(u.Hostname()); err != nil {
+			return err
+		}
+	}
+	hook.ID = randomID(16)
+	if hook.Secret == "" {
+		hook.Secret = randomID(32)
+	}
+	hook.Created = time.Now()
+	hook.LastRPGain = nil
+
+	w.lock.Lock()
+	w.hooks[hook.ID] = hook
+	w.lock.Unlock()
+	return w.save()
+}
+
+// Get returns a copy of a webhook without its delivery state.
+func (w *Webhooks) Get(id string) (*Webhook, bool) {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	hook, ok := w.hooks[id]
+	if !ok {
+		return nil, false
+	}
+	h := *hook
+	h.LastRPGain = nil
+	return &h, true
+}
+
+func (w *Webhooks) Delete(id string) (bool, error) {
+	w.lock.Lock()
+	_, ok := w.hooks[id]
+	delete(w.hooks, id)
+	w.lock.Unlock()
+	if !ok {
+		return false, nil
+	}
+	return true, w.save()
+}
+
+// Notify queues a notification for a single webhook.
+func (w *Webhooks) Notify(hook *Webhook, n *Notification) error {
+	body, err := hook.payload(n)
+	if err != nil {
+		return err
+	}
+	d := &delivery{
+		ID:     randomID(8),
+		URL:    hook.URL,
+		Type:   n.Type,
+		Secret: hook.Secret,
+		Body:   body,
+	}
+	select {
+	case w.queue <- d:
+		return nil
+	default:
+		return errors.New("webhook queue is full")
+	}
+}
+
+func (w *Webhooks) worker() {
+	for d := range w.queue {
+		err := w.deliver(d)
+		if err == nil {
+			continue
+		}
+		d.Attempt += 1
+		if d.Attempt >= WEBHOOK_MAX_ATTEMPTS {
+			log.Printf("Giving up on webhook delivery %v to %v: %v", d.ID, d.URL, err)
+			continue
+		}
+		backoff := time.Duration(1<<uint(d.Attempt)) * w.backoff
+		log.Printf("Webhook delivery %v to %v failed, retrying in %v: %v", d.ID, d.URL, backoff, err)
+		time.AfterFunc(backoff, func() {
+			// don't block the timer, a full queue drops the retry
+			select {
+			case w.queue <- d:
+			default:
+				log.Printf("Dropping webhook delivery %v to %v: queue is full", d.ID, d.URL)
+			}
+		})
+	}
+}
+
+func (w *Webhooks) deliver(d *delivery) error {
+	req, err := http.NewRequest(http.MethodPost, d.URL, bytes.NewReader(d.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "UthgardCommunityHerald-Webhook")
+	req.Header.Set("X-Herald-Delivery", d.ID)
+	req.Header.Set("X-Herald-Event", d.Type)
+	req.Header.Set("X-Herald-Signature", sign(d.Secret, d.Body))
+
+	response, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	ioutil.ReadAll(response.Body)
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %v", response.Status)
+	}
+	return nil
+}
+
+func characterRank(query *Query, name string, n int) int {
+	for i, c := range query.SortedByRP[:min(n, len(query.SortedByRP))] {
+		if strings.EqualFold(c.Name, name) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func guildRank(guilds GuildsByRP, name string, n int) int {
+	for i, g := range guilds[:min(n, len(guilds))] {
+		if strings.EqualFold(g.Name, name) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func ladderNotification(topN, prevRank, rank int, now time.Time) *Notification {
+	if (prevRank == 0) == (rank == 0) {
+		return nil
+	}
+	return &Notification{
+		Type:      NotificationLadder,
+		Timestamp: now,
+		TopN:      topN,
+		Rank:      rank,
+		Entered:   rank != 0,
+	}
+}
+
+// notifications collects everything a webhook has to be told about after
+// an update from prev to cur.
+func (w *Webhooks) notifications(hook *Webhook, prev, cur *Statistics, events []*Event, now time.Time) []*Notification {
+	results := make([]*Notification, 0)
+
+	for _, e := range events {
+		if hook.watchesEvent(e) {
+			results = append(results, &Notification{
+				Type:      NotificationMilestone,
+				Timestamp: e.Timestamp,
+				Character: e.Character,
+				Guild:     e.Guild,
+				Message:   eventMessage(e),
+				Event:     e,
+			})
+		}
+	}
+
+	if hook.TopN > 0 && prev != nil {
+		for _, name := range hook.Characters {
+			n := ladderNotification(hook.TopN, characterRank(&prev.Query, name, hook.TopN), characterRank(&cur.Query, name, hook.TopN), now)
+			if n == nil {
+				continue
+			}
+			n.Character = name
+			if n.Entered {
+				n.Message = fmt.Sprintf("%v entered the top %v RP ladder at rank %v", name, hook.TopN, n.Rank)
+			} else {
+				n.Message = fmt.Sprintf("%v left the top %v RP ladder", name, hook.TopN)
+			}
+			results = append(results, n)
+		}
+		for _, name := range hook.Guilds {
+			n := ladderNotification(hook.TopN, guildRank(prev.TopRPGuilds, name, hook.TopN), guildRank(cur.TopRPGuilds, name, hook.TopN), now)
+			if n == nil {
+				continue
+			}
+			n.Guild = name
+			if n.Entered {
+				n.Message = fmt.Sprintf("%v entered the top %v guild RP ladder at rank %v", name, hook.TopN, n.Rank)
+			} else {
+				n.Message = fmt.Sprintf("%v left the top %v guild RP ladder", name, hook.TopN)
+			}
+			results = append(results, n)
+		}
+	}
+
+	if hook.RPGain > 0 {
+		window, _ := hook.window()
+		since := now.Add(-1 * window)
+		check := func(name string, ts *timeseries.TimeSeries) *Notification {
+			key := strings.ToLower(name)
+			if ts == nil || hook.LastRPGain[key].After(since) {
+				return nil
+			}
+			rp := ts.ValueSince(since)
+			if rp <= hook.RPGain {
+				return nil
+			}
+			if hook.LastRPGain == nil {
+				hook.LastRPGain = make(map[string]time.Time)
+			}
+			hook.LastRPGain[key] = now
+			return &Notification{
+				Type:      NotificationRPGain,
+				Timestamp: now,
+				Message:   fmt.Sprintf("%v gained %v RP within %v", name, rp, window),
+				RP:        rp,
+				Window:    window.String(),
+			}
+		}
+		for _, name := range hook.Characters {
+			if n := check(name, timeseries.CharacterRPTimeSeries(name)); n != nil {
+				n.Character = name
+				results = append(results, n)
+			}
+		}
+		for _, name := range hook.Guilds {
+			if n := check(name, timeseries.GuildRPTimeSeries(name)); n != nil {
+				n.Guild = name
+				results = append(results, n)
+			}
+		}
+	}
+
+	return results
+}
+
+// NotifyAll evaluates every webhook after an update and queues the
+// resulting deliveries. The webhooks are copied, so that series are read
+// without holding the lock.
+func (w *Webhooks) NotifyAll(prev, cur *Statistics, events []*Event, now time.Time) {
+	log.Println("Notifying webhooks")
+	w.lock.RLock()
+	hooks := make([]*Webhook, 0, len(w.hooks))
+	for _, hook := range w.hooks {
+		h := *hook
+		h.LastRPGain = make(map[string]time.Time, len(hook.LastRPGain))
+		for key, t := range hook.LastRPGain {
+			h.LastRPGain[key] = t
+		}
+		hooks = append(hooks, &h)
+	}
+	w.lock.RUnlock()
+
+	queued := 0
+	for _, hook := range hooks {
+		for _, n := range w.notifications(hook, prev, cur, events, now) {
+			if err := w.Notify(hook, n); err != nil {
+				log.Printf("Failed to queue notification for webhook %v: %v", hook.ID, err)
+				continue
+			}
+			queued += 1
+		}
+	}
+
+	// keep the delivery state of webhooks that weren't deleted meanwhile
+	w.lock.Lock()
+	for _, hook := range hooks {
+		if h, ok := w.hooks[hook.ID]; ok {
+			h.LastRPGain = hook.LastRPGain
+		}
+	}
+	w.lock.Unlock()
+
+	if err := w.save(); err != nil {
+		log.Printf("Failed to save webhooks: %v", err)
+	}
+	log.Printf("Done, %v notifications queued", queued)
+}
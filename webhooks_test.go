@@ -0,0 +1,210 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andir/UthgardCommunityHeraldBackend/timeseries"
+	"github.com/gorilla/mux"
+)
+
+func TestWebhookRegistrationRejectsPrivateAddresses(t *testing.T) {
+	w := loadWebhooks(filepath.Join(t.TempDir(), "webhooks.json"), "token")
+	for _, u := range []string{
+		"http://localhost/hook",
+		"http://127.0.0.1/hook",
+		"http://10.1.2.3/hook",
+		"http://192.168.0.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://100.64.0.1/hook",
+		"http://0.0.0.0/hook",
+		"http://[::1]/hook",
+		"http://[fd00::1]/hook",
+	} {
+		hook := &Webhook{URL: u, Characters: []string{"Alice"}}
+		if err := w.Register(hook); err == nil {
+			t.Errorf("%v was accepted", u)
+		}
+	}
+	hook := &Webhook{URL: "https://93.184.216.34/hook", Characters: []string{"Alice"}}
+	if err := w.Register(hook); err != nil {
+		t.Errorf("public address rejected: %v", err)
+	}
+
+	// addresses are checked again when connecting
+	server := httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		t.Error("delivered to a local address")
+	}))
+	defer server.Close()
+	if err := w.deliver(&delivery{URL: server.URL}); err == nil {
+		t.Error("delivery to a local address succeeded")
+	}
+}
+
+func TestWebhookAuthorized(t *testing.T) {
+	for _, c := range []struct {
+		token, header string
+		ok            bool
+	}{
+		{"secret", "Bearer secret", true},
+		{"secret", "Bearer wrong", false},
+		{"secret", "", false},
+		// registration is disabled without a token
+		{"", "Bearer ", false},
+	} {
+		w := loadWebhooks(filepath.Join(t.TempDir(), "webhooks.json"), c.token)
+		req := httptest.NewRequest(http.MethodPost, "/webhooks", nil)
+		if c.header != "" {
+			req.Header.Set("Authorization", c.header)
+		}
+		if got := w.Authorized(req); got != c.ok {
+			t.Errorf("token %q, header %q: authorized = %v", c.token, c.header, got)
+		}
+	}
+}
+
+func TestWebhookDeliveryRetries(t *testing.T) {
+	var lock sync.Mutex
+	attempts := make([]time.Time, 0)
+	signatures := make([]string, 0)
+	bodies := make([][]byte, 0)
+	done := make(chan bool)
+	server := httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		lock.Lock()
+		defer lock.Unlock()
+		attempts = append(attempts, time.Now())
+		signatures = append(signatures, req.Header.Get("X-Herald-Signature"))
+		bodies = append(bodies, body)
+		// fail the first two attempts
+		if len(attempts) < 3 {
+			wr.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		close(done)
+	}))
+	defer server.Close()
+
+	w := loadWebhooks(filepath.Join(t.TempDir(), "webhooks.json"), "token")
+	w.client = server.Client()
+	w.allowPrivate = true
+	w.backoff = 20 * time.Millisecond
+	w.start(1)
+
+	hook := &Webhook{URL: server.URL, Characters: []string{"Alice"}}
+	if err := w.Register(hook); err != nil {
+		t.Fatal(err)
+	}
+	n := &Notification{Type: NotificationTest, Timestamp: time.Now(), Message: "test"}
+	if err := w.Notify(hook, n); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("delivery did not succeed")
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(attempts) != 3 {
+		t.Fatalf("%v attempts, want 3", len(attempts))
+	}
+	// the delay doubles with every attempt
+	for i, want := range []time.Duration{2 * w.backoff, 4 * w.backoff} {
+		if got := attempts[i+1].Sub(attempts[i]); got < want {
+			t.Errorf("retry %v after %v, want at least %v", i+1, got, want)
+		}
+	}
+	for i := range attempts {
+		if signatures[i] != sign(hook.Secret, bodies[i]) {
+			t.Errorf("attempt %v has signature %v", i, signatures[i])
+		}
+	}
+}
+
+func TestWebhookRPGainSingleSample(t *testing.T) {
+	t.Chdir(t.TempDir())
+	now := time.Date(2026, time.January, 10, 0, 0, 0, 0, time.UTC)
+	path := timeseries.TimeSeriesPath("character", "Alice", "rp")
+
+	w := loadWebhooks(filepath.Join(t.TempDir(), "webhooks.json"), "token")
+	hook := &Webhook{Characters: []string{"Alice"}, RPGain: 1000}
+	stats := LoadCharacters(map[string]*Character{"Alice": {Name: "Alice"}})
+
+	// one sample within the window is no gain
+	writeSeries(t, path, map[time.Time]uint64{
+		now.Add(-72 * time.Hour): 2000000,
+		now.Add(-2 * time.Hour):  2000500,
+	})
+	if n := w.notifications(hook, stats, stats, nil, now); len(n) != 0 {
+		t.Fatalf("notified about %v RP", n[0].RP)
+	}
+
+	writeSeries(t, path, map[time.Time]uint64{now.Add(-1 * time.Hour): 2002000})
+	n := w.notifications(hook, stats, stats, nil, now)
+	if len(n) != 1 || n[0].RP != 2000 {
+		t.Fatalf("got %+v, want a single gain of 2000 RP", n)
+	}
+}
+
+func TestWebhookManagementRequiresToken(t *testing.T) {
+	old := webhooks
+	defer func() { webhooks = old }()
+	webhooks = loadWebhooks(filepath.Join(t.TempDir(), "webhooks.json"), "token")
+	webhooks.allowPrivate = true
+	hook := &Webhook{URL: "http://127.0.0.1:1/hook", Characters: []string{"Alice"}}
+	if err := webhooks.Register(hook); err != nil {
+		t.Fatal(err)
+	}
+
+	var err interface{}
+	r := mux.NewRouter()
+	r.HandleFunc("/webhooks/{webhookID}", func(wr http.ResponseWriter, req *http.Request) {
+		_, err = webhookEndpoint(wr, req)
+	})
+	r.HandleFunc("/webhooks/{webhookID}/test", func(wr http.ResponseWriter, req *http.Request) {
+		_, err = testWebhookEndpoint(wr, req)
+	})
+	call := func(method, path, token string) interface{} {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		err = nil
+		r.ServeHTTP(httptest.NewRecorder(), req)
+		return err
+	}
+	unauthorized := func(err interface{}) bool {
+		e, ok := err.(*HTTPError)
+		return ok && e.Status == http.StatusUnauthorized
+	}
+
+	for _, token := range []string{"", "wrong"} {
+		if err := call(http.MethodGet, "/webhooks/"+hook.ID, token); !unauthorized(err) {
+			t.Errorf("GET with token %q: %v", token, err)
+		}
+		if err := call(http.MethodDelete, "/webhooks/"+hook.ID, token); !unauthorized(err) {
+			t.Errorf("DELETE with token %q: %v", token, err)
+		}
+		if err := call(http.MethodPost, "/webhooks/"+hook.ID+"/test", token); !unauthorized(err) {
+			t.Errorf("test with token %q: %v", token, err)
+		}
+	}
+	if _, ok := webhooks.Get(hook.ID); !ok {
+		t.Fatal("webhook was deleted without the token")
+	}
+
+	if err := call(http.MethodDelete, "/webhooks/"+hook.ID, "token"); err != nil {
+		t.Fatalf("DELETE with the token: %v", err)
+	}
+	if _, ok := webhooks.Get(hook.ID); ok {
+		t.Error("webhook still exists after DELETE")
+	}
+}